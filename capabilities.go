@@ -0,0 +1,93 @@
+package podman
+
+import (
+	"context"
+	"fmt"
+
+	args "go.flow.arcalot.io/podmandeployer/internal/argsbuilder"
+	"go.flow.arcalot.io/podmandeployer/internal/cliwrapper"
+	"go.flow.arcalot.io/podmandeployer/internal/util"
+)
+
+// Capabilities describe the podman installation the connector deploys through, as detected when the connector is
+// created.
+type Capabilities struct {
+	// ClientVersion is the version of the podman CLI; empty for the api backend.
+	ClientVersion string
+	// ServerVersion is the version of the podman service.
+	ServerVersion string
+	// Rootless is true if the podman service runs the containers without root privileges.
+	Rootless bool
+	// CgroupVersion is the cgroup version of the host, "v1" or "v2".
+	CgroupVersion string
+	// OCIRuntime is the name of the OCI runtime running the containers, e.g. "crun".
+	OCIRuntime string
+	// NetworkBackend is the network backend of podman, "netavark" or "cni".
+	NetworkBackend string
+}
+
+// detectCapabilities runs podman version and podman info through the wrapper and checks that both the client and the
+// service are at least the minimum version.
+func detectCapabilities(ctx context.Context, wrapper cliwrapper.CliWrapper, minimumVersion util.Version) (Capabilities, error) {
+	version, err := wrapper.Version(ctx)
+	if err != nil {
+		return Capabilities{}, fmt.Errorf("failed to detect the podman version (%w)", err)
+	}
+	info, err := wrapper.Info(ctx)
+	if err != nil {
+		return Capabilities{}, fmt.Errorf("failed to detect the podman host capabilities (%w)", err)
+	}
+	serverVersion := info.Version
+	if serverVersion == "" {
+		serverVersion = version.Server
+	}
+	if serverVersion == "" {
+		// A local podman CLI runs the containers itself.
+		serverVersion = version.Client
+	}
+	capabilities := Capabilities{
+		ClientVersion:  version.Client,
+		ServerVersion:  serverVersion,
+		Rootless:       info.Rootless,
+		CgroupVersion:  info.CgroupVersion,
+		OCIRuntime:     info.OCIRuntime,
+		NetworkBackend: info.NetworkBackend,
+	}
+	if capabilities.ClientVersion != "" {
+		if err := checkMinimumVersion("CLI", capabilities.ClientVersion, minimumVersion); err != nil {
+			return Capabilities{}, err
+		}
+	}
+	if err := checkMinimumVersion("service", capabilities.ServerVersion, minimumVersion); err != nil {
+		return Capabilities{}, err
+	}
+	return capabilities, nil
+}
+
+// checkMinimumVersion checks that the version of the podman component is at least the minimum version.
+func checkMinimumVersion(component string, version string, minimumVersion util.Version) error {
+	parsed, err := util.ParseVersion(version)
+	if err != nil {
+		return fmt.Errorf("failed to parse the version of the podman %s (%w)", component, err)
+	}
+	if parsed.Less(minimumVersion) {
+		return fmt.Errorf(
+			"the podman %s has version %s, but the deployer requires version %s or later",
+			component,
+			version,
+			minimumVersion,
+		)
+	}
+	return nil
+}
+
+// host returns the description of the podman host the container arguments are built for.
+func (c Capabilities) host() args.Host {
+	// The version was checked when the capabilities were detected.
+	version, _ := util.ParseVersion(c.ServerVersion)
+	return args.Host{
+		Version:       version,
+		Rootless:      c.Rootless,
+		CgroupVersion: c.CgroupVersion,
+	}
+}
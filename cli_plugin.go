@@ -1,21 +1,43 @@
 package podman
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"sync/atomic"
+	"time"
 
+	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-units"
 	log "go.arcalot.io/log/v2"
 	"go.flow.arcalot.io/podmandeployer/internal/cliwrapper"
 )
 
+// exitStatusWaitTimeout bounds how long reaching the end of the plugin output
+// waits for the podman process to exit, so that its exit status can be reported.
+const exitStatusWaitTimeout = 5 * time.Second
+
+// processReapTimeout bounds how long Close() waits for the podman process to
+// be reaped after the container was removed.
+const processReapTimeout = 30 * time.Second
+
 type CliPlugin struct {
+	// The context of the deployment; the plugin is killed when it is done.
+	ctx            context.Context
 	wrapper        cliwrapper.CliWrapper
 	containerImage string
 	containerName  string
+	stopSignal     string
 	config         *Config
 	logger         log.Logger
+	process        cliwrapper.Process
 	stdin          io.WriteCloser
 	stdout         io.ReadCloser
+	// The ephemeral podman secrets of the container, removed on Close().
+	secrets []string
+	// Set once Close() starts, after which the end of the output is expected.
+	closing atomic.Bool
 }
 
 func (p *CliPlugin) Write(b []byte) (n int, err error) {
@@ -23,43 +45,146 @@ func (p *CliPlugin) Write(b []byte) (n int, err error) {
 }
 
 func (p *CliPlugin) Read(b []byte) (n int, err error) {
-	return p.stdout.Read(b)
+	n, err = p.stdout.Read(b)
+	switch {
+	case err == nil || p.closing.Load():
+		return n, err
+	case p.ctx.Err() != nil:
+		return n, fmt.Errorf("plugin container %s was stopped because its context is done (%w)", p.containerName, p.ctx.Err())
+	}
+	return n, p.unexpectedExitError(err)
 }
 
-func (p *CliPlugin) Close() error {
-	containerRunning, err := p.wrapper.ContainerRunning(p.containerImage)
-	if err != nil {
-		p.logger.Warningf("error while checking if container exists (%s);"+
-			" killing container in case it still exists", err.Error())
-	} else if containerRunning {
-		p.logger.Infof("container %s still exists; killing container", p.containerName)
+// unexpectedExitError describes the termination of the plugin container when
+// its output ends before the plugin is closed. A container which exited
+// successfully results in the original error, normally io.EOF.
+func (p *CliPlugin) unexpectedExitError(err error) error {
+	select {
+	case <-p.process.Done():
+	case <-time.After(exitStatusWaitTimeout):
 	}
-	var killErr error
-	if err != nil || containerRunning {
-		killErr = p.wrapper.Kill(p.containerName)
+	status := p.process.ExitStatus()
+	stderr := p.process.Stderr()
+	var msg string
+	switch {
+	case status != nil && status.Success():
+		return err
+	case status != nil && status.OOMKilled:
+		msg = fmt.Sprintf("plugin container %s %s", p.containerName, status)
+		if limit := p.memoryLimit(); limit > 0 {
+			msg += fmt.Sprintf("; its memory limit is %s", units.BytesSize(float64(limit)))
+		}
+	case status != nil:
+		msg = fmt.Sprintf("plugin container %s %s", p.containerName, status)
+	case stderr != "":
+		msg = fmt.Sprintf("plugin container %s exited unexpectedly", p.containerName)
+	default:
+		return err
+	}
+	if stderr != "" {
+		return fmt.Errorf("%s (%w); stderr:\n%s", msg, err, stderr)
 	}
+	return fmt.Errorf("%s (%w)", msg, err)
+}
 
-	// Still clean up even if the kill fails. Clean() uses the --force parameter, so that
-	// will be another attempt at killing the container.
-	cleanErr := p.wrapper.Clean(p.containerName)
+// memoryLimit returns the configured memory limit of the plugin container in bytes, or 0 if it is unlimited.
+func (p *CliPlugin) memoryLimit() int64 {
+	if p.config.Deployment.HostConfig == nil {
+		return 0
+	}
+	return p.config.Deployment.HostConfig.Memory
+}
+
+// ExitStatus returns how the plugin container terminated, or nil if it is
+// still running.
+func (p *CliPlugin) ExitStatus() *cliwrapper.ExitStatus {
+	return p.process.ExitStatus()
+}
+
+// Ports returns the host addresses the published container ports are bound to, keyed by the container port in the
+// port/protocol format. Host ports chosen by podman, for example for bindings without a host port, are resolved.
+func (p *CliPlugin) Ports(ctx context.Context) (nat.PortMap, error) {
+	return p.wrapper.Ports(ctx, p.containerName)
+}
 
+func (p *CliPlugin) Close() error {
+	p.closing.Store(true)
+	// The deployment context may already be done, but the container must be
+	// cleaned up regardless.
+	ctx := context.Background()
+
+	// Closing stdin first gives the plugin the chance to exit on its own.
 	if err := p.stdin.Close(); err != nil {
 		p.logger.Warningf("failed to close stdin pipe")
 	} else {
 		p.logger.Debugf("stdin pipe successfully closed")
 	}
+	killErr := p.stopContainer(ctx)
+
+	// Still clean up even if the kill fails. Clean() uses the --force parameter, so that
+	// will be another attempt at killing the container.
+	cleanErr := p.wrapper.Clean(ctx, p.containerName)
+
 	if err := p.stdout.Close(); err != nil {
 		p.logger.Warningf("failed to close stdout pipe")
 	} else {
 		p.logger.Debugf("stdout pipe successfully closed")
 	}
+	select {
+	case <-p.process.Done():
+		p.logger.Debugf("podman process of container %s reaped; the container %s", p.containerName, p.process.ExitStatus())
+	case <-time.After(processReapTimeout):
+		p.logger.Warningf("podman process of container %s did not exit within %s", p.containerName, processReapTimeout)
+	}
+	var closeErr error
 	switch {
 	case killErr != nil && cleanErr != nil:
-		return fmt.Errorf("error while killing container (%s) and cleaning up container (%s)", killErr.Error(), cleanErr.Error())
+		closeErr = fmt.Errorf("error while killing container (%s) and cleaning up container (%s)", killErr.Error(), cleanErr.Error())
 	case killErr != nil:
-		return killErr
+		closeErr = killErr
 	case cleanErr != nil:
-		return cleanErr
+		closeErr = cleanErr
+	}
+	// The secrets can only be removed once the container no longer uses them.
+	if err := removeSecrets(ctx, p.wrapper, p.secrets); err != nil {
+		closeErr = errors.Join(closeErr, fmt.Errorf("error while removing the secrets of container %s (%w)", p.containerName, err))
+	}
+	if closeErr == nil {
+		return nil
+	}
+	if stderr := p.process.Stderr(); stderr != "" {
+		return fmt.Errorf("%w; stderr of container %s:\n%s", closeErr, p.containerName, stderr)
+	}
+	return closeErr
+}
+
+// stopContainer sends the stop signal to a still running container and kills
+// it if it does not exit within the grace period.
+func (p *CliPlugin) stopContainer(ctx context.Context) error {
+	state, err := p.wrapper.InspectContainer(ctx, p.containerName)
+	switch {
+	case errors.Is(err, cliwrapper.ErrNoSuchContainer):
+		p.logger.Infof("container %s exited on its own and no longer exists", p.containerName)
+		return nil
+	case err != nil:
+		p.logger.Warningf("error while checking the state of container %s (%s);"+
+			" killing container in case it still exists", p.containerName, err.Error())
+		return p.wrapper.Kill(ctx, p.containerName)
+	case !state.Running:
+		p.logger.Infof("container %s exited on its own (status %s, exit code %d)", p.containerName, state.Status, state.ExitCode)
+		return nil
+	}
+
+	gracePeriod := p.config.Deployment.GracePeriod
+	p.logger.Debugf("container %s still running; sending %s and waiting up to %s", p.containerName, p.stopSignal, gracePeriod)
+	forceKilled, err := p.wrapper.Stop(ctx, p.containerName, p.stopSignal, gracePeriod)
+	switch {
+	case err != nil:
+		return err
+	case forceKilled:
+		p.logger.Warningf("container %s did not exit within %s after %s; force killed", p.containerName, gracePeriod, p.stopSignal)
+	default:
+		p.logger.Infof("container %s stopped gracefully after %s", p.containerName, p.stopSignal)
 	}
 	return nil
 }
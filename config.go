@@ -1,9 +1,15 @@
 package podman
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
+	"go.flow.arcalot.io/podmandeployer/internal/cliwrapper"
+	"go.flow.arcalot.io/podmandeployer/internal/util"
 )
 
 type Config struct {
@@ -14,7 +20,63 @@ type Config struct {
 
 // Validate checks the configuration structure for conformance with the schema.
 func (c *Config) Validate() error {
-	return Schema.ValidateType(c)
+	if err := Schema.ValidateType(c); err != nil {
+		return err
+	}
+	return c.validateOptions()
+}
+
+// validateOptions checks the constraints on options that the schema cannot express.
+func (c *Config) validateOptions() error {
+	if err := c.Podman.validate(); err != nil {
+		return err
+	}
+	switch {
+	case c.Deployment.ConnectionName == nil:
+	case c.Podman.Backend == BackendAPI:
+		return fmt.Errorf("the deployment connectionName is only used by the %s backend", BackendCLI)
+	case c.Podman.URL != "":
+		return errors.New("the deployment connectionName and the podman url are mutually exclusive")
+	}
+	if _, err := compileSensitivePatterns(c.Podman.SensitivePatterns); err != nil {
+		return err
+	}
+	if err := validateRegistries(c.Deployment.Registries, c.localPodman()); err != nil {
+		return err
+	}
+	if verification := c.Deployment.ImageVerification; verification != nil {
+		if err := verification.validate(c.Deployment.ImagePullPolicy, c.localPodman()); err != nil {
+			return err
+		}
+	}
+	if err := validateEnvPassthrough(c.Deployment.EnvPassthrough); err != nil {
+		return err
+	}
+	if err := validateMounts(c.Deployment.Mounts); err != nil {
+		return err
+	}
+	if err := validateSecrets(c.Deployment.Secrets); err != nil {
+		return err
+	}
+	if err := validateExtraArgs(c.Deployment.ExtraArgs); err != nil {
+		return err
+	}
+	if podmanOptions := c.Deployment.PodmanOptions; podmanOptions != nil {
+		if podmanOptions.UserNS != "" && (len(podmanOptions.UIDMap) > 0 || len(podmanOptions.GIDMap) > 0) {
+			return fmt.Errorf("the podman user namespace mode %s cannot be combined with UID or GID maps", podmanOptions.UserNS)
+		}
+	}
+	return nil
+}
+
+// localPodman reports whether the deployer runs a podman CLI which pulls the images itself, rather than the api
+// backend or a podman CLI talking to a podman service through a connection name or URL. Only a local podman CLI reads
+// the pull options referring to files on the engine host.
+func (c *Config) localPodman() bool {
+	return c.Podman.Backend != BackendAPI &&
+		c.Podman.URL == "" &&
+		c.Podman.ConnectionName == nil &&
+		c.Deployment.ConnectionName == nil
 }
 
 // ImagePullPolicy drives when an image should be pulled.
@@ -40,6 +102,93 @@ type Podman struct {
 	RngSeed int64 `json:"rngSeed"`
 	// Specify the optional --connection parameter for podman
 	ConnectionName *string `json:"connectionName"`
+	// URL is the unix://, tcp:// or ssh:// URL of a remote podman service, which does not need to be added as a
+	// named connection first.
+	URL string `json:"url"`
+	// Identity is the path of the SSH identity file on the engine host for ssh:// URLs.
+	Identity string `json:"identity"`
+	// SensitivePatterns are regular expressions whose matches are masked in the logged podman command lines and in
+	// the podman output included in errors.
+	SensitivePatterns []string `json:"sensitivePatterns"`
+	// Backend selects whether the deployer runs the podman CLI or talks to the podman REST API.
+	Backend Backend `json:"backend"`
+	// APIURL is the unix:// or tcp:// URL of the podman service the api backend talks to.
+	APIURL string `json:"apiURL"`
+	// MinimumVersion is the oldest podman version the connector accepts, checked against the podman CLI and service
+	// when the connector is created. Empty selects DefaultMinimumVersion.
+	MinimumVersion string `json:"minimumVersion"`
+}
+
+// DefaultMinimumVersion is the oldest podman version the deployer supports by default.
+const DefaultMinimumVersion = "4.0.0"
+
+// minimumVersion returns the parsed minimum podman version.
+func (p Podman) minimumVersion() (util.Version, error) {
+	if p.MinimumVersion == "" {
+		return util.ParseVersion(DefaultMinimumVersion)
+	}
+	version, err := util.ParseVersion(p.MinimumVersion)
+	if err != nil {
+		return util.Version{}, fmt.Errorf("invalid minimumVersion (%w)", err)
+	}
+	return version, nil
+}
+
+// Backend drives how the deployer talks to podman.
+type Backend string
+
+const (
+	// BackendCLI runs the podman CLI.
+	BackendCLI Backend = "cli"
+	// BackendAPI talks to the libpod REST API of a podman service, e.g. one started with podman system service.
+	BackendAPI Backend = "api"
+)
+
+// connection returns the podman connection of the CLI backend.
+func (p Podman) connection() cliwrapper.Connection {
+	connection := cliwrapper.Connection{URL: p.URL, Identity: p.Identity}
+	if p.ConnectionName != nil {
+		connection.Name = *p.ConnectionName
+	}
+	return connection
+}
+
+// validate checks that the connection options match the backend.
+func (p Podman) validate() error {
+	if _, err := p.minimumVersion(); err != nil {
+		return err
+	}
+	switch {
+	case p.Backend == BackendAPI && p.APIURL == "":
+		return fmt.Errorf("the %s backend requires the apiURL of the podman service", BackendAPI)
+	case p.Backend == BackendAPI && p.ConnectionName != nil:
+		return fmt.Errorf("the connectionName is only used by the %s backend; set the apiURL of the connection instead", BackendCLI)
+	case p.Backend != BackendAPI && p.APIURL != "":
+		return fmt.Errorf("the apiURL is only used by the %s backend", BackendAPI)
+	case p.Backend == BackendAPI && (p.URL != "" || p.Identity != ""):
+		return fmt.Errorf("the url and identity are only used by the %s backend; set the apiURL instead", BackendCLI)
+	case p.URL != "" && p.ConnectionName != nil:
+		return errors.New("the url and the connectionName are mutually exclusive")
+	case p.Identity != "" && !strings.HasPrefix(p.URL, "ssh://"):
+		return errors.New("the identity is only used with an ssh:// url")
+	case p.APIURL != "":
+		_, _, err := cliwrapper.ParseAPIURL(p.APIURL)
+		return err
+	}
+	return nil
+}
+
+// compileSensitivePatterns compiles the sensitive patterns of the podman configuration.
+func compileSensitivePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sensitive pattern %q (%w)", pattern, err)
+		}
+		compiled[i] = re
+	}
+	return compiled, nil
 }
 
 // Deployment contains the information about deploying the plugin.
@@ -48,10 +197,124 @@ type Deployment struct {
 	HostConfig      *container.HostConfig `json:"host"`
 	ImagePullPolicy ImagePullPolicy       `json:"imagePullPolicy"`
 	ImagePlatform   *string               `json:"imagePlatform"`
-	ConnectionName  *string               `json:"connectionName"`
+	// ConnectionName is the podman connection to deploy the plugin through, overriding the connection of the podman
+	// configuration.
+	ConnectionName *string `json:"connectionName"`
+	// Registries hold the credentials and TLS options for pulling plugin images from private or internal registries.
+	Registries []Registry `json:"registries"`
+	// ImageVerification restricts the plugin images which may be run to allowed digests or valid signatures.
+	ImageVerification *ImageVerification `json:"imageVerification"`
+	// PodmanOptions holds the podman-specific options that the Docker container and host configuration cannot express.
+	PodmanOptions *PodmanOptions `json:"podman"`
+	// StopSignal is the signal sent to a container still running when the plugin is closed.
+	StopSignal string `json:"stopSignal"`
+	// EnvFiles are env files on the engine host whose variables are set on the plugin container.
+	EnvFiles []string `json:"envFiles"`
+	// EnvPassthrough are names or glob patterns of engine environment variables forwarded to the plugin container.
+	EnvPassthrough []string `json:"envPassthrough"`
+	// Mounts are the bind, volume, tmpfs and image mounts of the plugin container.
+	Mounts []Mount `json:"mounts"`
+	// Secrets are credentials passed to the plugin container through ephemeral podman secrets.
+	Secrets []Secret `json:"secrets"`
+	// ExtraArgs are additional podman run arguments, added before the image name.
+	ExtraArgs []string `json:"extraArgs"`
+	// GracePeriod is how long closing the plugin waits for the container to exit after the stop signal before killing
+	// it. Zero kills it immediately.
+	GracePeriod time.Duration `json:"gracePeriod"`
+}
+
+// PodmanOptions are deployment options specific to podman.
+type PodmanOptions struct {
+	// UserNS is the user namespace mode, e.g. keep-id or auto.
+	UserNS string `json:"userns"`
+	// UIDMap maps UIDs in the container to UIDs on the host in the container_uid:from_uid:amount format.
+	UIDMap []string `json:"uidmap"`
+	// GIDMap maps GIDs in the container to GIDs on the host in the container_gid:from_gid:amount format.
+	GIDMap []string `json:"gidmap"`
+	// Pod is the existing pod to run the container in, or new:name to create one.
+	Pod string `json:"pod"`
+	// Secrets are the podman secrets to expose to the container.
+	Secrets []string `json:"secrets"`
+	// SecurityOpts are security options, e.g. label=disable or no-new-privileges.
+	SecurityOpts []string `json:"securityOpt"`
+	// ReadOnlyTmpfs drives whether tmpfs mounts are read-write on a read-only container. Unset keeps the podman
+	// default.
+	ReadOnlyTmpfs *bool `json:"readOnlyTmpfs"`
+	// SDNotify is the sd-notify mode of the container.
+	SDNotify SDNotifyMode `json:"sdnotify"`
 }
 
-// Timeouts drive the timeouts for various interactions in relation to Docker.
+// SDNotifyMode determines how the container's readiness is reported to systemd.
+type SDNotifyMode string
+
+const (
+	// SDNotifyModeContainer passes the NOTIFY_SOCKET to the container.
+	SDNotifyModeContainer SDNotifyMode = "container"
+	// SDNotifyModeConmon makes conmon report readiness once the container started.
+	SDNotifyModeConmon SDNotifyMode = "conmon"
+	// SDNotifyModeHealthy reports readiness once the container turned healthy.
+	SDNotifyModeHealthy SDNotifyMode = "healthy"
+	// SDNotifyModeIgnore does not report readiness.
+	SDNotifyModeIgnore SDNotifyMode = "ignore"
+)
+
+// DefaultStopSignal is the default signal sent to a container still running when the plugin is closed.
+const DefaultStopSignal = "SIGTERM"
+
+// DefaultGracePeriod is the default time a closed plugin has to exit before it is killed.
+const DefaultGracePeriod = 10 * time.Second
+
+// Timeouts drive the timeouts for the podman commands run by the deployer. A zero value selects the default.
 type Timeouts struct {
-	HTTP time.Duration `json:"http"`
+	// ImagePull bounds the duration of podman pull.
+	ImagePull time.Duration `json:"imagePull"`
+	// ContainerStart bounds the time between launching podman run and the container reaching the running state.
+	ContainerStart time.Duration `json:"containerStart"`
+	// ATPHandshake bounds the time between the container starting and the plugin's first output on stdout.
+	ATPHandshake time.Duration `json:"atpHandshake"`
+	// Kill bounds the duration of podman kill.
+	Kill time.Duration `json:"kill"`
+	// Remove bounds the duration of podman rm.
+	Remove time.Duration `json:"remove"`
+	// SecretCreate bounds the duration of podman secret create.
+	SecretCreate time.Duration `json:"secretCreate"`
+	// Probe bounds the duration of podman version and podman info when the connector is created.
+	Probe time.Duration `json:"probe"`
+}
+
+// Default timeouts for the podman commands run by the deployer.
+const (
+	DefaultImagePullTimeout      = 10 * time.Minute
+	DefaultContainerStartTimeout = time.Minute
+	DefaultATPHandshakeTimeout   = 2 * time.Minute
+	DefaultKillTimeout           = 30 * time.Second
+	DefaultRemoveTimeout         = 30 * time.Second
+	DefaultSecretCreateTimeout   = 30 * time.Second
+	DefaultProbeTimeout          = 30 * time.Second
+)
+
+// withDefaults returns a copy of the timeouts with zero values replaced by the defaults.
+func (t Timeouts) withDefaults() Timeouts {
+	if t.ImagePull == 0 {
+		t.ImagePull = DefaultImagePullTimeout
+	}
+	if t.ContainerStart == 0 {
+		t.ContainerStart = DefaultContainerStartTimeout
+	}
+	if t.ATPHandshake == 0 {
+		t.ATPHandshake = DefaultATPHandshakeTimeout
+	}
+	if t.Kill == 0 {
+		t.Kill = DefaultKillTimeout
+	}
+	if t.Remove == 0 {
+		t.Remove = DefaultRemoveTimeout
+	}
+	if t.SecretCreate == 0 {
+		t.SecretCreate = DefaultSecretCreateTimeout
+	}
+	if t.Probe == 0 {
+		t.Probe = DefaultProbeTimeout
+	}
+	return t
 }
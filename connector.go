@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"os"
+	"slices"
+	"strings"
 	"sync"
 
 	"github.com/docker/docker/api/types/container"
@@ -18,8 +21,16 @@ type Connector struct {
 	containerNamePrefix string
 	config              *Config
 	logger              log.Logger
-	podmanCliWrapper    cliwrapper.CliWrapper
-	rng                 *rand.Rand
+	// The wrapper of the podman connection of the connector.
+	podmanCliWrapper cliwrapper.CliWrapper
+	// Creates the wrapper of a podman connection.
+	newWrapper func(connection cliwrapper.Connection) cliwrapper.CliWrapper
+	// The wrappers of the deployment connections overriding the connection of
+	// the connector, keyed by connection name and created on first use.
+	connectionWrappers map[string]cliwrapper.CliWrapper
+	// The capabilities of the podman installation the deployments use.
+	capabilities Capabilities
+	rng          *rand.Rand
 	// Random Number Generator to facilitate the generation
 	// of random strings for the container name suffix.
 	rngSeed int64
@@ -32,49 +43,112 @@ func (c *Connector) Deploy(ctx context.Context, image string) (deployer.Plugin,
 	if err := c.pullImage(ctx, image); err != nil {
 		return nil, err
 	}
-	if c.config.Podman.Path == "" {
+	runImage, err := c.verifyImage(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	if c.config.Podman.Backend != BackendAPI && c.config.Podman.Path == "" {
 		c.logger.Errorf("oops, neither podman -> path provided in configuration nor binary found in $PATH")
 		panic("oops, neither podman -> path provided in configuration nor binary found in $PATH")
 	}
 
 	containerConfig := c.unwrapContainerConfig()
 	hostConfig := c.unwrapHostConfig()
+	podmanOptions := c.unwrapPodmanOptions()
 	commandArgs := []string{"run", "-i", "-a", "stdin", "-a", "stdout", "-a", "stderr"}
 	containerName := c.NextContainerName(c.containerNamePrefix, 10)
 
-	args.NewBuilder(&commandArgs).
+	networkMode := string(hostConfig.NetworkMode)
+	if containerConfig.NetworkDisabled && networkMode != "" {
+		c.logger.Warningf("container networking is disabled; ignoring network mode %s", networkMode)
+		networkMode = ""
+	}
+
+	env, err := c.containerEnv(containerConfig.Env)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := args.NewHostBuilder(&commandArgs, c.capabilities.host())
+	builder.
 		SetContainerName(containerName).
-		SetEnv(containerConfig.Env).
+		SetHostname(containerConfig.Hostname).
+		SetDomainname(containerConfig.Domainname).
+		SetUser(containerConfig.User).
+		SetEnv(env).
 		SetVolumes(hostConfig.Binds).
+		SetMounts(mountSpecs(c.config.Deployment.Mounts)).
 		SetCgroupNs(string(hostConfig.CgroupnsMode)).
-		SetNetworkMode(string(hostConfig.NetworkMode)).
-		SetPrivileged(hostConfig.Privileged)
+		SetNetworkDisabled(containerConfig.NetworkDisabled).
+		SetNetworkMode(networkMode).
+		SetMacAddress(containerConfig.MacAddress). //nolint:staticcheck // Podman still supports the deprecated field.
+		SetDNS(hostConfig.DNS).
+		SetDNSOptions(hostConfig.DNSOptions).
+		SetDNSSearch(hostConfig.DNSSearch).
+		SetExtraHosts(hostConfig.ExtraHosts).
+		SetPortBindings(hostConfig.PortBindings).
+		SetPrivileged(hostConfig.Privileged).
+		SetCapAdd(hostConfig.CapAdd).
+		SetCapDrop(hostConfig.CapDrop).
+		SetMemory(hostConfig.Memory).
+		SetMemorySwap(hostConfig.MemorySwap).
+		SetNanoCPUs(hostConfig.NanoCPUs).
+		SetCPUShares(hostConfig.CPUShares).
+		SetCpusetCpus(hostConfig.CpusetCpus).
+		SetPidsLimit(hostConfig.PidsLimit).
+		SetUlimits(hostConfig.Ulimits).
+		SetUserNS(podmanOptions.UserNS).
+		SetUIDMap(podmanOptions.UIDMap).
+		SetGIDMap(podmanOptions.GIDMap).
+		SetPod(podmanOptions.Pod).
+		SetSecrets(slices.Concat(podmanOptions.Secrets, secretSpecs(c.config.Deployment.Secrets, containerName))).
+		SetSecurityOpts(podmanOptions.SecurityOpts).
+		SetReadOnlyTmpfs(podmanOptions.ReadOnlyTmpfs).
+		SetSDNotify(string(podmanOptions.SDNotify)).
+		SetStopSignal(c.stopSignal())
+	if err := builder.Err(); err != nil {
+		return nil, fmt.Errorf("invalid plugin container configuration, rejected entries:\n%w", err)
+	}
+	commandArgs = append(commandArgs, c.config.Deployment.ExtraArgs...)
+
+	wrapper := c.wrapper()
+	secrets, err := createSecrets(ctx, wrapper, c.config.Deployment.Secrets, containerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the secrets of container %s (%w)", containerName, err)
+	}
 
-	stdin, stdout, err := c.podmanCliWrapper.Deploy(image, commandArgs, []string{"--atp"})
+	process, err := wrapper.Deploy(ctx, runImage, containerName, commandArgs, []string{"--atp"})
 
 	if err != nil {
+		if removeErr := removeSecrets(context.Background(), wrapper, secrets); removeErr != nil {
+			c.logger.Warningf("failed to remove the secrets of container %s (%s)", containerName, removeErr.Error())
+		}
 		return nil, err
 	}
 
 	cliPlugin := CliPlugin{
-		wrapper:        c.podmanCliWrapper,
+		ctx:            ctx,
+		stopSignal:     c.stopSignal(),
+		wrapper:        wrapper,
 		containerImage: image,
 		containerName:  containerName,
+		secrets:        secrets,
 		config:         c.config,
-		stdin:          stdin,
-		stdout:         stdout,
+		process:        process,
+		stdin:          process.Stdin(),
+		stdout:         process.Stdout(),
 		logger:         c.logger,
 	}
 
 	return &cliPlugin, nil
 }
 
-func (c *Connector) pullImage(_ context.Context, image string) error {
-	if c.config.Deployment.ImagePullPolicy == ImagePullPolicyNever {
+func (c *Connector) pullImage(ctx context.Context, image string) error {
+	switch c.config.Deployment.ImagePullPolicy {
+	case ImagePullPolicyNever:
 		return nil
-	}
-	if c.config.Deployment.ImagePullPolicy == ImagePullPolicyIfNotPresent {
-		imageExists, err := c.podmanCliWrapper.ImageExists(image)
+	case ImagePullPolicyIfNotPresent:
+		imageExists, err := c.wrapper().ImageExists(ctx, image)
 		if err != nil {
 			return err
 		}
@@ -83,13 +157,151 @@ func (c *Connector) pullImage(_ context.Context, image string) error {
 			return nil
 		}
 		c.logger.Debugf("Pulling image '%s'", image)
-		if err := c.podmanCliWrapper.PullImage(image, c.config.Deployment.ImagePlatform); err != nil {
-			return err
-		}
+		return c.pull(ctx, image)
+	case ImagePullPolicyAlways:
+		return c.repullImage(ctx, image)
 	}
 	return nil
 }
 
+// repullImage pulls the image unconditionally, comparing the digest of the
+// local copy before and after the pull so that the logs show whether the
+// image actually changed.
+func (c *Connector) repullImage(ctx context.Context, image string) error {
+	previousDigest, err := c.localImageDigest(ctx, image)
+	if err != nil {
+		return err
+	}
+	c.logger.Debugf("Pulling image '%s'", image)
+	if err := c.pull(ctx, image); err != nil {
+		return err
+	}
+	currentDigest, err := c.wrapper().ImageDigest(ctx, image)
+	if err != nil {
+		return err
+	}
+	switch previousDigest {
+	case "":
+		c.logger.Debugf("%s: pulled image with digest %s", image, currentDigest)
+	case currentDigest:
+		c.logger.Debugf("%s: local image is up to date (digest %s)", image, currentDigest)
+	default:
+		c.logger.Infof("%s: local image updated from digest %s to %s", image, previousDigest, currentDigest)
+	}
+	return nil
+}
+
+// pull pulls the image with the credentials and TLS options of the registry it is pulled from, if configured.
+func (c *Connector) pull(ctx context.Context, image string) error {
+	options := cliwrapper.PullOptions{
+		Platform:        c.config.Deployment.ImagePlatform,
+		SignaturePolicy: c.unwrapImageVerification().SignaturePolicy,
+	}
+	registry := matchRegistry(c.config.Deployment.Registries, image)
+	if registry == nil {
+		return c.wrapper().PullImage(ctx, image, options)
+	}
+	c.logger.Debugf("%s: pulling with the options of registry %s", image, registry.Host)
+	authFile, err := registry.writeAuthFile()
+	if err != nil {
+		return err
+	}
+	if authFile != "" {
+		defer func() {
+			if err := os.Remove(authFile); err != nil {
+				c.logger.Warningf("failed to remove the temporary authentication file %s (%s)", authFile, err.Error())
+			}
+		}()
+	} else {
+		authFile = registry.AuthFile
+	}
+	options.AuthFile = authFile
+	options.TLSVerify = registry.TLSVerify
+	options.CertDir = registry.CertDir
+	return c.wrapper().PullImage(ctx, image, options)
+}
+
+// verifyImage checks the image against the allowed digests and returns the reference to run it by, which is pinned
+// to the verified digest so that the image cannot change between the check and the run.
+func (c *Connector) verifyImage(ctx context.Context, image string) (string, error) {
+	verification := c.unwrapImageVerification()
+	if len(verification.AllowedDigests) == 0 {
+		return image, nil
+	}
+	repoDigests, err := c.wrapper().ImageRepoDigests(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	reference, err := verification.allowedReference(image, repoDigests)
+	if err != nil {
+		return "", err
+	}
+	c.logger.Debugf("%s: digest verified; running %s", image, reference)
+	return reference, nil
+}
+
+// localImageDigest returns the digest of the local copy of the image, or an
+// empty string if the image is not present locally.
+func (c *Connector) localImageDigest(ctx context.Context, image string) (string, error) {
+	imageExists, err := c.wrapper().ImageExists(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	if !*imageExists {
+		return "", nil
+	}
+	return c.wrapper().ImageDigest(ctx, image)
+}
+
+// Capabilities returns the capabilities of the podman installation the connector deploys through.
+func (c *Connector) Capabilities() Capabilities {
+	return c.capabilities
+}
+
+// wrapper returns the wrapper of the podman connection of the deployment, which
+// overrides the connection of the connector.
+func (c *Connector) wrapper() cliwrapper.CliWrapper {
+	connectionName := c.config.Deployment.ConnectionName
+	if connectionName == nil {
+		return c.podmanCliWrapper
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	wrapper, found := c.connectionWrappers[*connectionName]
+	if !found {
+		c.logger.Debugf("using podman connection %s for the deployment", *connectionName)
+		wrapper = c.newWrapper(cliwrapper.Connection{Name: *connectionName})
+		c.connectionWrappers[*connectionName] = wrapper
+	}
+	return wrapper
+}
+
+func (c *Connector) stopSignal() string {
+	if c.config.Deployment.StopSignal != "" {
+		return c.config.Deployment.StopSignal
+	}
+	return DefaultStopSignal
+}
+
+// containerEnv combines the variables of the env files, the forwarded engine variables and the configured variables,
+// in increasing order of precedence.
+func (c *Connector) containerEnv(configEnv []string) ([]string, error) {
+	env, err := readEnvFiles(c.config.Deployment.EnvFiles)
+	if err != nil {
+		return nil, fmt.Errorf("invalid env files:\n%w", err)
+	}
+	forwarded := passthroughEnv(c.config.Deployment.EnvPassthrough, os.Environ())
+	if len(forwarded) > 0 {
+		names := make([]string, len(forwarded))
+		for i, entry := range forwarded {
+			names[i], _, _ = strings.Cut(entry, "=")
+		}
+		c.logger.Debugf("forwarding engine environment variables %s", strings.Join(names, ", "))
+	}
+	env = append(env, forwarded...)
+	return append(env, configEnv...), nil
+}
+
 func (c *Connector) unwrapContainerConfig() container.Config {
 	if c.config.Deployment.ContainerConfig != nil {
 		return *c.config.Deployment.ContainerConfig
@@ -104,6 +316,20 @@ func (c *Connector) unwrapHostConfig() container.HostConfig {
 	return container.HostConfig{}
 }
 
+func (c *Connector) unwrapPodmanOptions() PodmanOptions {
+	if c.config.Deployment.PodmanOptions != nil {
+		return *c.config.Deployment.PodmanOptions
+	}
+	return PodmanOptions{}
+}
+
+func (c *Connector) unwrapImageVerification() ImageVerification {
+	if c.config.Deployment.ImageVerification != nil {
+		return *c.config.Deployment.ImageVerification
+	}
+	return ImageVerification{}
+}
+
 func (c *Connector) NextContainerName(containerNamePrefix string, randomStrSize int) string {
 	c.lock.Lock()
 	defer c.lock.Unlock()
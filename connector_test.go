@@ -4,11 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
 	"github.com/opencontainers/selinux/go-selinux"
 	"io"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -16,6 +23,7 @@ import (
 	"go.arcalot.io/assert"
 	"go.arcalot.io/log/v2"
 	"go.flow.arcalot.io/deployer"
+	"go.flow.arcalot.io/podmandeployer/internal/cliwrapper"
 	"go.flow.arcalot.io/podmandeployer/tests"
 )
 
@@ -568,7 +576,7 @@ func readOutputUntil(t *testing.T, plugin io.Reader, lookForOutput string) []byt
 		copy(readBuffer[n:], currentBuffer[:readBytes])
 		n += readBytes
 
-		if err == io.EOF {
+		if errors.Is(err, io.EOF) {
 			break
 		} else if err != nil {
 			t.Fatalf("error while reading stdout: %s", err.Error())
@@ -628,3 +636,1796 @@ func testNetworking(
 		assert.Contains(t, string(readBuffer), *mac)
 	}
 }
+
+// fakePodmanImageScript emulates the podman subcommands used for pulling
+// images.  The local image is listed only if the "present" file exists next
+// to the script; its digest is read from the "digest" file, which a pull
+// overwrites with a new digest.  A pull copies the authentication file to the
+// "auth.json" file, since temporary authentication files are removed after it.
+const fakePodmanImageScript = `
+dir="$(dirname "$0")"
+case "$1" in
+  image)
+    case "$2" in
+      ls)
+        if [ -f "$dir/present" ]; then echo "quay.io/arcalot/fake-plugin:latest"; fi
+        ;;
+      inspect)
+        cat "$dir/digest"
+        ;;
+    esac
+    ;;
+  pull)
+    echo "sha256:pulled" > "$dir/digest"
+    touch "$dir/present"
+    previous=""
+    for arg in "$@"; do
+      if [ "$previous" = "--authfile" ]; then cp "$arg" "$dir/auth.json"; fi
+      previous="$arg"
+    done
+    ;;
+esac
+`
+
+var pullPolicyTemplate = `
+{
+   "podman":{
+      "path":"%s"
+   },
+   "deployment":{
+      "imagePullPolicy":"%s",
+      "imagePlatform":"linux/arm64"
+   }
+}
+`
+
+type pullPolicyScenario struct {
+	policy         ImagePullPolicy
+	localDigest    string
+	expectPull     bool
+	expectedLogMsg string
+}
+
+func TestImagePullPolicy(t *testing.T) {
+	scenarios := map[string]pullPolicyScenario{
+		"Never, image absent":         {ImagePullPolicyNever, "", false, ""},
+		"Never, image present":        {ImagePullPolicyNever, "sha256:local", false, ""},
+		"IfNotPresent, image absent":  {ImagePullPolicyIfNotPresent, "", true, "Pulling image"},
+		"IfNotPresent, image present": {ImagePullPolicyIfNotPresent, "sha256:local", false, "image already present"},
+		"Always, image absent":        {ImagePullPolicyAlways, "", true, "pulled image with digest sha256:pulled"},
+		"Always, image unchanged":     {ImagePullPolicyAlways, "sha256:pulled", true, "local image is up to date"},
+		"Always, image changed": {
+			ImagePullPolicyAlways, "sha256:local", true, "local image updated from digest sha256:local to sha256:pulled",
+		},
+	}
+
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanImageScript)
+			if scenario.localDigest != "" {
+				dir := filepath.Dir(podmanPath)
+				assert.NoError(t, os.WriteFile(filepath.Join(dir, "present"), nil, 0o600))
+				assert.NoError(t, os.WriteFile(filepath.Join(dir, "digest"), []byte(scenario.localDigest), 0o600))
+			}
+			connector, _ := getConnector(t, fmt.Sprintf(pullPolicyTemplate, podmanPath, scenario.policy))
+			logs := log.NewBufferWriter()
+			connector.(*Connector).logger = log.NewLogger(log.LevelDebug, logs)
+
+			assert.NoError(t, connector.(*Connector).pullImage(context.Background(), "quay.io/arcalot/fake-plugin"))
+
+			var pulls []string
+			for _, invocation := range tests.GetFakePodmanInvocations(t, invocationLog) {
+				if strings.HasPrefix(invocation, "pull ") {
+					pulls = append(pulls, invocation)
+				}
+			}
+			if scenario.expectPull {
+				assert.Equals(t, pulls, []string{"pull --platform linux/arm64 quay.io/arcalot/fake-plugin:latest"})
+			} else {
+				assert.Equals(t, len(pulls), 0)
+			}
+			assert.Contains(t, logs.String(), scenario.expectedLogMsg)
+		})
+	}
+}
+
+var registriesTemplate = `
+{
+   "podman":{
+      "path":"%s"
+   },
+   "deployment":{
+      "registries":%s
+   }
+}
+`
+
+func TestRegistryPullOptions(t *testing.T) {
+	scenarios := map[string]struct {
+		registries       string
+		expectedPull     string
+		expectedAuthFile string
+	}{
+		"NoMatch": {
+			`[{"host":"registry.example.com","username":"robot","password":"hunter2"}]`,
+			"pull quay.io/arcalot/fake-plugin:latest",
+			"",
+		},
+		"Credentials": {
+			`[{"host":"quay.io","username":"robot","password":"hunter2","tlsVerify":false,"certDir":"/etc/certs"}]`,
+			"pull --authfile * --tls-verify=false --cert-dir /etc/certs quay.io/arcalot/fake-plugin:latest",
+			`{"auths":{"quay.io":{"auth":"cm9ib3Q6aHVudGVyMg=="}}}`,
+		},
+		"MostSpecificToken": {
+			`[{"host":"quay.io","username":"robot","password":"hunter2"},{"host":"quay.io/arcalot","token":"t0ken"}]`,
+			"pull --authfile * quay.io/arcalot/fake-plugin:latest",
+			`{"auths":{"quay.io/arcalot":{"identitytoken":"t0ken"}}}`,
+		},
+		"AuthFile": {
+			`[{"host":"quay.io","authFile":"/etc/containers/auth.json"}]`,
+			"pull --authfile /etc/containers/auth.json quay.io/arcalot/fake-plugin:latest",
+			"",
+		},
+	}
+	for name, s := range scenarios {
+		t.Run(name, func(t *testing.T) {
+			podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanImageScript)
+			connector, _ := getConnector(t, fmt.Sprintf(registriesTemplate, podmanPath, s.registries))
+			logs := log.NewBufferWriter()
+			connector.(*Connector).logger = log.NewLogger(log.LevelDebug, logs)
+
+			assert.NoError(t, connector.(*Connector).pullImage(context.Background(), "quay.io/arcalot/fake-plugin"))
+
+			invocations := tests.GetFakePodmanInvocations(t, invocationLog)
+			pull := invocations[assert.SliceContainsMatch(t, func(invocation string) bool {
+				return strings.HasPrefix(invocation, "pull ")
+			}, invocations)]
+			if s.expectedAuthFile == "" {
+				assert.Equals(t, pull, s.expectedPull)
+				return
+			}
+			// The temporary authentication file is removed after the pull.
+			fields := strings.Fields(pull)
+			authFile := fields[slices.Index(fields, "--authfile")+1]
+			assert.Equals(t, strings.Replace(pull, authFile, "*", 1), s.expectedPull)
+			_, err := os.Stat(authFile)
+			assert.Equals(t, os.IsNotExist(err), true)
+			auth := assert.NoErrorR[[]byte](t)(os.ReadFile(filepath.Join(filepath.Dir(podmanPath), "auth.json")))
+			assert.Equals(t, string(auth), s.expectedAuthFile)
+			assert.Equals(t, strings.Contains(logs.String(), "hunter2"), false)
+		})
+	}
+}
+
+func TestRegistriesValidation(t *testing.T) {
+	tlsVerify := false
+	scenarios := map[string]struct {
+		registries     []Registry
+		expectedErrMsg string
+	}{
+		"Credentials": {[]Registry{{Host: "quay.io", Username: "robot", Password: "hunter2"}}, ""},
+		"TLSOnly":     {[]Registry{{Host: "registry.lab:5000/plugins", TLSVerify: &tlsVerify}}, ""},
+		"NoPassword":  {[]Registry{{Host: "quay.io", Username: "robot"}}, "has a username but no password"},
+		"NoUsername":  {[]Registry{{Host: "quay.io", Password: "hunter2"}}, "has a password but no username"},
+		"TokenAndAuthFile": {
+			[]Registry{{Host: "quay.io", Token: "t0ken", AuthFile: "/etc/containers/auth.json"}},
+			"can only use one of username and password, token or authFile",
+		},
+		"InvalidHost": {[]Registry{{Host: "https://quay.io"}}, "host"},
+		"DuplicateHost": {
+			[]Registry{{Host: "quay.io", Token: "t0ken"}, {Host: "quay.io", Username: "robot", Password: "hunter2"}},
+			"multiple registries have the host quay.io",
+		},
+	}
+	for name, s := range scenarios {
+		t.Run(name, func(t *testing.T) {
+			config := &Config{Deployment: Deployment{Registries: s.registries, ImagePullPolicy: ImagePullPolicyIfNotPresent}}
+			err := config.Validate()
+			if s.expectedErrMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), s.expectedErrMsg)
+			}
+		})
+	}
+}
+
+const (
+	allowedDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	otherDigest   = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+var imageVerificationTemplate = `
+{
+   "podman":{
+      "path":"%s"
+   },
+   "deployment":{
+      "imageVerification":{
+         "allowedDigests":["` + allowedDigest + `"]
+      }
+   }
+}
+`
+
+func TestImageVerification(t *testing.T) {
+	scenarios := map[string]struct {
+		repoDigests    []string
+		expectedImage  string
+		expectedErrMsg string
+	}{
+		"Allowed": {
+			[]string{"quay.io/arcalot/fake-plugin@" + otherDigest, "quay.io/arcalot/fake-plugin@" + allowedDigest},
+			"quay.io/arcalot/fake-plugin@" + allowedDigest,
+			"",
+		},
+		"NotAllowed": {
+			[]string{"quay.io/arcalot/fake-plugin@" + otherDigest},
+			"",
+			"image quay.io/arcalot/fake-plugin is not allowed; none of its digests " + otherDigest + " is in the allowed digests",
+		},
+		"NoRepoDigests": {nil, "", "has no repository digest to verify"},
+	}
+	for name, s := range scenarios {
+		t.Run(name, func(t *testing.T) {
+			podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exec cat"))
+			repoDigests := strings.Join(s.repoDigests, "\n")
+			assert.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(podmanPath), "repo_digests"), []byte(repoDigests), 0o600))
+			connector, _ := getConnector(t, fmt.Sprintf(imageVerificationTemplate, podmanPath))
+
+			plugin, err := connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin")
+			if s.expectedErrMsg != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), s.expectedErrMsg)
+				// The image is rejected before podman run is invoked.
+				invocations := tests.GetFakePodmanInvocations(t, invocationLog)
+				assert.Equals(t, slices.ContainsFunc(invocations, func(invocation string) bool {
+					return strings.HasPrefix(invocation, "run ")
+				}), false)
+				return
+			}
+			assert.NoError(t, err)
+			t.Cleanup(func() { assert.NoError(t, plugin.Close()) })
+			// The container runs the verified digest rather than the tag.
+			assert.Contains(t, getRunInvocation(t, invocationLog), " "+s.expectedImage+" --atp")
+		})
+	}
+}
+
+var signaturePolicyTemplate = `
+{
+   "podman":{
+      "path":"%s"
+   },
+   "deployment":{
+      "imagePullPolicy":"Always",
+      "imageVerification":{
+         "signaturePolicy":"/etc/containers/policy.json"
+      }
+   }
+}
+`
+
+func TestImageSignaturePolicy(t *testing.T) {
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanImageScript)
+	connector, _ := getConnector(t, fmt.Sprintf(signaturePolicyTemplate, podmanPath))
+
+	assert.NoError(t, connector.(*Connector).pullImage(context.Background(), "quay.io/arcalot/fake-plugin"))
+	assert.SliceContains(
+		t,
+		"pull --signature-policy /etc/containers/policy.json quay.io/arcalot/fake-plugin:latest",
+		tests.GetFakePodmanInvocations(t, invocationLog),
+	)
+
+	// Images which are not pulled cannot be verified.
+	config := &Config{Deployment: Deployment{
+		ImagePullPolicy:   ImagePullPolicyIfNotPresent,
+		ImageVerification: &ImageVerification{SignaturePolicy: "/etc/containers/policy.json"},
+	}}
+	err := config.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "verifying image signatures requires the Always image pull policy")
+}
+
+func TestLocalPodmanPullOptions(t *testing.T) {
+	connectionName := "remote"
+	verification := &ImageVerification{SignaturePolicy: "/etc/containers/policy.json"}
+	registries := []Registry{{Host: "registry.lab:5000", CertDir: "/etc/containers/certs.d/registry.lab:5000"}}
+	podmanConfigs := map[string]struct {
+		podman           Podman
+		deploymentRemote bool
+		expectedErrMsg   string
+	}{
+		"Local":                {Podman{}, false, ""},
+		"APIBackend":           {Podman{Backend: BackendAPI, APIURL: "unix:///run/podman/podman.sock"}, false, "requires a local podman CLI"},
+		"URL":                  {Podman{URL: "ssh://core@engine.lab/run/podman/podman.sock"}, false, "requires a local podman CLI"},
+		"ConnectionName":       {Podman{ConnectionName: &connectionName}, false, "requires a local podman CLI"},
+		"DeploymentConnection": {Podman{}, true, "requires a local podman CLI"},
+	}
+	for name, s := range podmanConfigs {
+		t.Run(name, func(t *testing.T) {
+			deployment := Deployment{ImagePullPolicy: ImagePullPolicyAlways}
+			if s.deploymentRemote {
+				deployment.ConnectionName = &connectionName
+			}
+			for _, option := range []func(d *Deployment){
+				func(d *Deployment) { d.ImageVerification = verification },
+				func(d *Deployment) { d.Registries = registries },
+			} {
+				config := &Config{Podman: s.podman, Deployment: deployment}
+				option(&config.Deployment)
+				err := config.Validate()
+				if s.expectedErrMsg == "" {
+					assert.NoError(t, err)
+				} else {
+					assert.Error(t, err)
+					assert.Contains(t, err.Error(), s.expectedErrMsg)
+				}
+			}
+		})
+	}
+}
+
+var timeoutsConfig = `
+{
+   "podman":{
+      "path":"podman"
+   },
+   "timeouts":{
+      "imagePull":"5m",
+      "kill":"10s"
+   }
+}
+`
+
+func TestTimeoutsConfig(t *testing.T) {
+	var rawConfig any
+	assert.NoError(t, json.Unmarshal([]byte(timeoutsConfig), &rawConfig))
+	config := assert.NoErrorR[*Config](t)(Schema.UnserializeType(rawConfig))
+	assert.Equals(t, config.Timeouts.ImagePull, 5*time.Minute)
+	assert.Equals(t, config.Timeouts.Kill, 10*time.Second)
+	// Unset timeouts fall back to the defaults.
+	assert.Equals(t, config.Timeouts.ContainerStart, DefaultContainerStartTimeout)
+	assert.Equals(t, Timeouts{}.withDefaults().Remove, DefaultRemoveTimeout)
+	assert.Equals(t, Timeouts{}.withDefaults().SecretCreate, DefaultSecretCreateTimeout)
+}
+
+var fakePodmanTemplate = `
+{
+   "podman":{
+      "path":"%s"
+   }
+}
+`
+
+// fakePodmanDeployScript emulates the podman subcommands used for running
+// and closing a plugin; the given script is run in place of the container.
+// The container counts as running while the process running the script is
+// alive; the "oom" and "no_such_container" files next to the podman script
+// alter the reported container state.  The repository digests of the image
+// are read from the "repo_digests" file.
+func fakePodmanDeployScript(runScript string) string {
+	return `
+dir="$(dirname "$0")"
+for arg in "$@"; do
+  case "$arg" in
+    --connection=*|--url=*|--identity=*) shift ;;
+    *) break ;;
+  esac
+done
+case "$1" in
+  image)
+    if [ "$2" = "inspect" ] && [ -f "$dir/repo_digests" ]; then cat "$dir/repo_digests"; fi
+    ;;
+  container)
+    if [ -f "$dir/no_such_container" ]; then echo "Error: no such container" >&2; exit 125; fi
+    oom=false
+    if [ -f "$dir/oom" ]; then oom=true; fi
+    if [ -f "$dir/pid" ] && kill -0 "$(cat "$dir/pid")" 2>/dev/null; then
+      echo '{"Status":"running","Running":true,"OOMKilled":'$oom'}'
+    else
+      echo '{"Status":"exited","Running":false,"OOMKilled":'$oom'}'
+    fi
+    ;;
+  run)
+    echo $$ > "$dir/pid"
+    ` + runScript + `
+    ;;
+  kill)
+    if [ "$2" = "--signal" ]; then
+      kill -s "${3#SIG}" "$(cat "$dir/pid")"
+    else
+      kill -9 "$(cat "$dir/pid")"
+    fi
+    ;;
+  rm)
+    if [ -f "$dir/pid" ]; then kill -9 "$(cat "$dir/pid")" 2>/dev/null; fi
+    ;;
+  port)
+    if [ -f "$dir/ports" ]; then cat "$dir/ports"; fi
+    ;;
+  secret)
+    if [ "$2" = "create" ]; then cat > "$dir/secret_$3"; fi
+    ;;
+esac
+`
+}
+
+func TestUnexpectedExitReportsStderr(t *testing.T) {
+	podmanPath, _ := tests.CreateFakePodman(t, fakePodmanDeployScript(`
+    echo "Traceback (most recent call last):" >&2
+    echo "ValueError: plugin crashed" >&2
+    exit 1
+`))
+	connector, _ := getConnector(t, fmt.Sprintf(fakePodmanTemplate, podmanPath))
+	plugin := assert.NoErrorR[deployer.Plugin](t)(connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin"))
+	t.Cleanup(func() { assert.NoError(t, plugin.Close()) })
+
+	_, err := plugin.Read(make([]byte, 1024))
+	assert.Error(t, err)
+	assert.Equals(t, errors.Is(err, io.EOF), true)
+	assert.Contains(t, err.Error(), "exited with code 1")
+	assert.Contains(t, err.Error(), "ValueError: plugin crashed")
+	assert.Equals(t, plugin.(*CliPlugin).ExitStatus().ExitCode, 1)
+}
+
+func TestExitStatus(t *testing.T) {
+	scenarios := map[string]struct {
+		script         string
+		expectedErrMsg string
+	}{
+		"Success":   {`echo "done" >&2; exit 0`, ""},
+		"Failure":   {`exit 3`, "exited with code 3"},
+		"Signal":    {`exit 143`, "was terminated by signal 15 (terminated)"},
+		"OOMKilled": {`touch "$dir/oom"; exit 137`, "was killed because it ran out of memory (OOM, exit code 137)"},
+		"Podman":    {`echo "Error: bad flag" >&2; exit 125`, "could not be run by podman (exit code 125)"},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			podmanPath, _ := tests.CreateFakePodman(t, fakePodmanDeployScript(scenario.script))
+			connector, _ := getConnector(t, fmt.Sprintf(fakePodmanTemplate, podmanPath))
+			plugin := assert.NoErrorR[deployer.Plugin](t)(connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin"))
+			t.Cleanup(func() { assert.NoError(t, plugin.Close()) })
+
+			_, err := plugin.Read(make([]byte, 1024))
+			if scenario.expectedErrMsg == "" {
+				assert.Equals(t, err, io.EOF)
+				assert.Equals(t, plugin.(*CliPlugin).ExitStatus().Success(), true)
+			} else {
+				assert.Equals(t, errors.Is(err, io.EOF), true)
+				assert.Contains(t, err.Error(), scenario.expectedErrMsg)
+			}
+		})
+	}
+}
+
+var gracePeriodTemplate = `
+{
+   "podman":{
+      "path":"%s"
+   },
+   "deployment":{
+      "stopSignal":"%s",
+      "gracePeriod":"%s"
+   }
+}
+`
+
+func TestCloseGracePeriod(t *testing.T) {
+	scenarios := map[string]struct {
+		script         string
+		stopSignal     string
+		gracePeriod    string
+		noContainer    bool
+		expectedSignal bool
+		expectedKill   bool
+		expectedLogMsg string
+	}{
+		"Exits on its own": {
+			`echo done; exit 0`, "SIGTERM", "10s", false, false, false, "exited on its own",
+		},
+		"Container is gone": {
+			`exec cat`, "SIGTERM", "10s", true, false, false, "exited on its own",
+		},
+		"Stops on signal": {
+			`trap "exit 0" INT; while true; do sleep 0.1; done`, "SIGINT", "10s", false, true, false, "stopped gracefully after SIGINT",
+		},
+		"Ignores signal": {
+			`trap "" TERM; exec sleep 30`, "SIGTERM", "200ms", false, true, true, "force killed",
+		},
+		"Without a grace period": {
+			`trap "" TERM; exec sleep 30`, "SIGTERM", "0s", false, true, true, "force killed",
+		},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript(scenario.script))
+			connector, _ := getConnector(t, fmt.Sprintf(gracePeriodTemplate, podmanPath, scenario.stopSignal, scenario.gracePeriod))
+			logs := log.NewBufferWriter()
+			connector.(*Connector).logger = log.NewLogger(log.LevelDebug, logs)
+			plugin := assert.NoErrorR[deployer.Plugin](t)(connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin"))
+			if scenario.noContainer {
+				assert.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(podmanPath), "no_such_container"), nil, 0o600))
+			} else if !scenario.expectedSignal {
+				// Wait for the container to exit on its own.
+				<-plugin.(*CliPlugin).process.Done()
+			}
+
+			start := time.Now()
+			assert.NoError(t, plugin.Close())
+			assert.Equals(t, time.Since(start) < 5*time.Second, true)
+
+			invocations := tests.GetFakePodmanInvocations(t, invocationLog)
+			signal := fmt.Sprintf("kill --signal %s %s", scenario.stopSignal, plugin.ID())
+			if scenario.expectedSignal {
+				assert.SliceContains(t, signal, invocations)
+			} else {
+				assert.SliceNotContains(t, signal, invocations)
+			}
+			if scenario.expectedKill {
+				assert.SliceContains(t, "kill "+plugin.ID(), invocations)
+			} else {
+				assert.SliceNotContains(t, "kill "+plugin.ID(), invocations)
+			}
+			assert.SliceContains(t, "rm --force "+plugin.ID(), invocations)
+			assert.NotNil(t, plugin.(*CliPlugin).ExitStatus())
+			assert.Contains(t, logs.String(), scenario.expectedLogMsg)
+		})
+	}
+}
+
+// getRunInvocation returns the arguments of the podman run invocation
+// recorded by the fake podman binary.
+func getRunInvocation(t *testing.T, invocationLog string) string {
+	for _, invocation := range tests.GetFakePodmanInvocations(t, invocationLog) {
+		if strings.HasPrefix(invocation, "run ") {
+			return invocation
+		}
+	}
+	t.Fatalf("podman run was not invoked")
+	return ""
+}
+
+var containerIdentityTemplate = `
+{
+   "podman":{
+      "path":"%s"
+   },
+   "deployment":{
+      "container":{
+         "Hostname":"plugin-host",
+         "Domainname":"example.com",
+         "User":"%s",
+         "NetworkDisabled":true,
+         "MacAddress":"44:33:22:11:00:99"
+      },
+      "host":{
+         "NetworkMode":"host"
+      }
+   }
+}
+`
+
+func TestContainerIdentityArgs(t *testing.T) {
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exec cat"))
+	connector, _ := getConnector(t, fmt.Sprintf(containerIdentityTemplate, podmanPath, "1000:1000"))
+	plugin := assert.NoErrorR[deployer.Plugin](t)(connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin"))
+	t.Cleanup(func() { assert.NoError(t, plugin.Close()) })
+
+	runArgs := getRunInvocation(t, invocationLog)
+	assert.Contains(t, runArgs, "--hostname plugin-host")
+	assert.Contains(t, runArgs, "--domainname example.com")
+	assert.Contains(t, runArgs, "--user 1000:1000")
+	assert.Contains(t, runArgs, "--mac-address 44:33:22:11:00:99")
+	// Disabling the network takes precedence over the network mode.
+	assert.Contains(t, runArgs, "--network none")
+	assert.Equals(t, strings.Contains(runArgs, "--network host"), false)
+}
+
+// configWithContainer returns a valid configuration using the container configuration.
+func configWithContainer(containerConfig *container.Config) *Config {
+	return &Config{Deployment: Deployment{ContainerConfig: containerConfig, ImagePullPolicy: ImagePullPolicyIfNotPresent}}
+}
+
+func TestContainerUserValidation(t *testing.T) {
+	for _, user := range []string{"nobody", "1000", "plugin:plugins", "1000:100", "nobody:100"} {
+		assert.NoError(t, configWithContainer(&container.Config{User: user}).Validate())
+	}
+	for _, user := range []string{"Root", "1000:", ":1000", "user:group:extra"} {
+		assert.Error(t, configWithContainer(&container.Config{User: user}).Validate())
+	}
+}
+
+var hostNetworkingTemplate = `
+{
+   "podman":{
+      "path":"%s"
+   },
+   "deployment":{
+      "host":{
+         "CapDrop":["ALL"],
+         "CapAdd":["NET_RAW"],
+         "Dns":["10.0.0.53"],
+         "DnsOptions":["ndots:2"],
+         "DnsSearch":["lab.example.com"],
+         "ExtraHosts":["registry.lab:10.0.0.5"]
+      }
+   }
+}
+`
+
+func TestHostNetworkingArgs(t *testing.T) {
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exec cat"))
+	connector, _ := getConnector(t, fmt.Sprintf(hostNetworkingTemplate, podmanPath))
+	plugin := assert.NoErrorR[deployer.Plugin](t)(connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin"))
+	t.Cleanup(func() { assert.NoError(t, plugin.Close()) })
+
+	runArgs := getRunInvocation(t, invocationLog)
+	assert.Contains(t, runArgs, "--cap-add NET_RAW")
+	assert.Contains(t, runArgs, "--cap-drop ALL")
+	assert.Contains(t, runArgs, "--dns 10.0.0.53")
+	assert.Contains(t, runArgs, "--dns-option ndots:2")
+	assert.Contains(t, runArgs, "--dns-search lab.example.com")
+	assert.Contains(t, runArgs, "--add-host registry.lab:10.0.0.5")
+}
+
+var portBindingsTemplate = `
+{
+   "podman":{
+      "path":"%s"
+   },
+   "deployment":{
+      "host":{
+         "PortBindings":{
+            "8080/tcp":[{"HostIP":"127.0.0.1","HostPort":"18080"}],
+            "9090":[]
+         }
+      }
+   }
+}
+`
+
+func TestPortBindings(t *testing.T) {
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exec cat"))
+	assert.NoError(t, os.WriteFile(
+		filepath.Join(filepath.Dir(podmanPath), "ports"),
+		[]byte("8080/tcp -> 127.0.0.1:18080\n9090/tcp -> 0.0.0.0:40123\n"),
+		0600,
+	))
+	connector, _ := getConnector(t, fmt.Sprintf(portBindingsTemplate, podmanPath))
+	plugin := assert.NoErrorR[deployer.Plugin](t)(connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin"))
+	t.Cleanup(func() { assert.NoError(t, plugin.Close()) })
+
+	runArgs := getRunInvocation(t, invocationLog)
+	assert.Contains(t, runArgs, "-p 127.0.0.1:18080:8080/tcp")
+	assert.Contains(t, runArgs, "-p 9090")
+
+	ports, err := plugin.(*CliPlugin).Ports(context.Background())
+	assert.NoError(t, err)
+	assert.Equals(t, ports, nat.PortMap{
+		"8080/tcp": {{HostIP: "127.0.0.1", HostPort: "18080"}},
+		"9090/tcp": {{HostIP: "0.0.0.0", HostPort: "40123"}},
+	})
+}
+
+func TestPortBindingsValidation(t *testing.T) {
+	scenarios := map[string]struct {
+		portBindings nat.PortMap
+		valid        bool
+	}{
+		"Port":            {nat.PortMap{"8080": {{HostPort: "18080"}}}, true},
+		"Protocol":        {nat.PortMap{"8080/udp": {{HostPort: "18080"}}}, true},
+		"Range":           {nat.PortMap{"9000-9010/tcp": {{HostPort: "19000-19010"}}}, true},
+		"HostIP":          {nat.PortMap{"8080/tcp": {{HostIP: "127.0.0.1", HostPort: "18080"}}}, true},
+		"HostIPv6":        {nat.PortMap{"8080/tcp": {{HostIP: "::1"}}}, true},
+		"RandomHostPort":  {nat.PortMap{"8080/tcp": {}}, true},
+		"UnknownProtocol": {nat.PortMap{"8080/http": {}}, false},
+		"NamedPort":       {nat.PortMap{"http": {}}, false},
+		"InvalidHostPort": {nat.PortMap{"8080": {{HostPort: "http"}}}, false},
+		"InvalidHostIP":   {nat.PortMap{"8080": {{HostIP: "localhost", HostPort: "18080"}}}, false},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			err := configWithHost(&container.HostConfig{PortBindings: scenario.portBindings}).Validate()
+			if scenario.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+var resourceLimitsTemplate = `
+{
+   "podman":{
+      "path":"%s"
+   },
+   "deployment":{
+      "host":{
+         "Memory":"64MB",
+         "MemorySwap":-1,
+         "NanoCpus":500000000,
+         "CpuShares":512,
+         "CpusetCpus":"0-1",
+         "PidsLimit":64,
+         "Ulimits":[{"Name":"nofile","Soft":1024,"Hard":2048}]
+      }
+   }
+}
+`
+
+func TestResourceLimitsArgs(t *testing.T) {
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exec cat"))
+	connector, _ := getConnector(t, fmt.Sprintf(resourceLimitsTemplate, podmanPath))
+	plugin := assert.NoErrorR[deployer.Plugin](t)(connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin"))
+	t.Cleanup(func() { assert.NoError(t, plugin.Close()) })
+
+	runArgs := getRunInvocation(t, invocationLog)
+	assert.Contains(t, runArgs, "--memory 67108864")
+	assert.Contains(t, runArgs, "--memory-swap -1")
+	assert.Contains(t, runArgs, "--cpus 0.5")
+	assert.Contains(t, runArgs, "--cpu-shares 512")
+	assert.Contains(t, runArgs, "--cpuset-cpus 0-1")
+	assert.Contains(t, runArgs, "--pids-limit 64")
+	assert.Contains(t, runArgs, "--ulimit nofile=1024:2048")
+}
+
+func TestOOMKilledReportsMemoryLimit(t *testing.T) {
+	podmanPath, _ := tests.CreateFakePodman(t, fakePodmanDeployScript(`touch "$dir/oom"; exit 137`))
+	connector, _ := getConnector(t, fmt.Sprintf(resourceLimitsTemplate, podmanPath))
+	plugin := assert.NoErrorR[deployer.Plugin](t)(connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin"))
+	t.Cleanup(func() { assert.NoError(t, plugin.Close()) })
+
+	_, err := plugin.Read(make([]byte, 1024))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "was killed because it ran out of memory (OOM, exit code 137)")
+	assert.Contains(t, err.Error(), "its memory limit is 64MiB")
+	assert.Equals(t, plugin.(*CliPlugin).ExitStatus().OOMKilled, true)
+}
+
+func TestResourceLimitsValidation(t *testing.T) {
+	scenarios := map[string]struct {
+		hostConfig container.HostConfig
+		valid      bool
+	}{
+		"CpusetCpusRange":    {container.HostConfig{Resources: container.Resources{CpusetCpus: "0-3"}}, true},
+		"CpusetCpusList":     {container.HostConfig{Resources: container.Resources{CpusetCpus: "0,2-3"}}, true},
+		"CpusetCpusInvalid":  {container.HostConfig{Resources: container.Resources{CpusetCpus: "all"}}, false},
+		"NegativeMemory":     {container.HostConfig{Resources: container.Resources{Memory: -1}}, false},
+		"UnlimitedSwap":      {container.HostConfig{Resources: container.Resources{MemorySwap: -1}}, true},
+		"NegativeCPUs":       {container.HostConfig{Resources: container.Resources{NanoCPUs: -1}}, false},
+		"TooManyCPUShares":   {container.HostConfig{Resources: container.Resources{CPUShares: 262145}}, false},
+		"Ulimit":             {container.HostConfig{Resources: container.Resources{Ulimits: []*container.Ulimit{{Name: "nproc", Soft: 64, Hard: 128}}}}, true},
+		"UlimitUnknownName":  {container.HostConfig{Resources: container.Resources{Ulimits: []*container.Ulimit{{Name: "files", Soft: 64, Hard: 128}}}}, false},
+		"UlimitInvalidLimit": {container.HostConfig{Resources: container.Resources{Ulimits: []*container.Ulimit{{Name: "nproc", Soft: -2, Hard: 128}}}}, false},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			err := configWithHost(&scenario.hostConfig).Validate()
+			if scenario.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+var podmanOptionsTemplate = `
+{
+   "podman":{
+      "path":"%s"
+   },
+   "deployment":{
+      "podman":{
+         "userns":"keep-id",
+         "pod":"plugins",
+         "secrets":["token,type=env,target=TOKEN"],
+         "securityOpt":["label=disable"],
+         "readOnlyTmpfs":true,
+         "sdnotify":"conmon"
+      }
+   }
+}
+`
+
+func TestPodmanOptionsArgs(t *testing.T) {
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exec cat"))
+	connector, _ := getConnector(t, fmt.Sprintf(podmanOptionsTemplate, podmanPath))
+	plugin := assert.NoErrorR[deployer.Plugin](t)(connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin"))
+	t.Cleanup(func() { assert.NoError(t, plugin.Close()) })
+
+	runArgs := getRunInvocation(t, invocationLog)
+	assert.Contains(t, runArgs, "--userns keep-id")
+	assert.Contains(t, runArgs, "--pod plugins")
+	assert.Contains(t, runArgs, "--secret token,type=env,target=TOKEN")
+	assert.Contains(t, runArgs, "--security-opt label=disable")
+	assert.Contains(t, runArgs, "--read-only-tmpfs=true")
+	assert.Contains(t, runArgs, "--sdnotify conmon")
+}
+
+func TestPodmanOptionsValidation(t *testing.T) {
+	scenarios := map[string]struct {
+		podmanOptions PodmanOptions
+		valid         bool
+	}{
+		"UserNSKeepID":          {PodmanOptions{UserNS: "keep-id"}, true},
+		"UserNSKeepIDOptions":   {PodmanOptions{UserNS: "keep-id:uid=1000,gid=1000"}, true},
+		"UserNSAuto":            {PodmanOptions{UserNS: "auto:size=65536"}, true},
+		"UserNSUnknown":         {PodmanOptions{UserNS: "keep"}, false},
+		"IDMaps":                {PodmanOptions{UIDMap: []string{"0:1:1000"}, GIDMap: []string{"+1000:@1000:1"}}, true},
+		"IDMapInvalid":          {PodmanOptions{UIDMap: []string{"0:1"}}, false},
+		"PodNew":                {PodmanOptions{Pod: "new:plugins"}, true},
+		"PodInvalid":            {PodmanOptions{Pod: "-plugins"}, false},
+		"SecretOptions":         {PodmanOptions{Secrets: []string{"token,type=mount,target=/run/token,mode=0400"}}, true},
+		"SecretUnknownOption":   {PodmanOptions{Secrets: []string{"token,path=/run/token"}}, false},
+		"SecurityOptLabel":      {PodmanOptions{SecurityOpts: []string{"label=type:spc_t"}}, true},
+		"SecurityOptNoNewPrivs": {PodmanOptions{SecurityOpts: []string{"no-new-privileges=true"}}, true},
+		"SecurityOptUnknown":    {PodmanOptions{SecurityOpts: []string{"privileged"}}, false},
+		"SDNotify":              {PodmanOptions{SDNotify: SDNotifyModeHealthy}, true},
+		"SDNotifyUnknown":       {PodmanOptions{SDNotify: "always"}, false},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			config := &Config{Deployment: Deployment{
+				PodmanOptions:   &scenario.podmanOptions,
+				ImagePullPolicy: ImagePullPolicyIfNotPresent,
+			}}
+			err := config.Validate()
+			if scenario.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestPodmanOptionsUserNSConflictsWithIDMaps(t *testing.T) {
+	config := &Config{Deployment: Deployment{
+		PodmanOptions:   &PodmanOptions{UserNS: "keep-id", UIDMap: []string{"0:1:1000"}},
+		ImagePullPolicy: ImagePullPolicyIfNotPresent,
+	}}
+	err := config.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be combined with UID or GID maps")
+
+	_, err = NewFactory().Create(config, log.NewTestLogger(t))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be combined with UID or GID maps")
+}
+
+var extraArgsTemplate = `
+{
+   "podman":{
+      "path":"%s"
+   },
+   "deployment":{
+      "extraArgs":["--label", "team=perf", "--env=DEBUG=1"]
+   }
+}
+`
+
+func TestExtraArgs(t *testing.T) {
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exec cat"))
+	connector, _ := getConnector(t, fmt.Sprintf(extraArgsTemplate, podmanPath))
+	plugin := assert.NoErrorR[deployer.Plugin](t)(connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin"))
+	t.Cleanup(func() { assert.NoError(t, plugin.Close()) })
+
+	runArgs := getRunInvocation(t, invocationLog)
+	assert.Contains(t, runArgs, "--label team=perf --env=DEBUG=1 quay.io/arcalot/fake-plugin:latest --atp")
+}
+
+func TestExtraArgsValidation(t *testing.T) {
+	scenarios := map[string]struct {
+		extraArgs      []string
+		expectedErrMsg string
+	}{
+		"Allowed":            {[]string{"--label", "team=perf", "-e", "DEBUG=1", "--read-only"}, ""},
+		"ValueLikeFlag":      {[]string{"-eDATA=1", "-v/data:/data"}, ""},
+		"DeniedFlagAsValue":  {[]string{"--label", "-d", "--env", "-i", "-l", "--rm", "--label=--name"}, ""},
+		"FlagAfterBoolean":   {[]string{"--privileged", "-d"}, "extra argument -d is not allowed"},
+		"FlagAfterValue":     {[]string{"-e", "DEBUG=1", "-i"}, "extra argument -i is not allowed"},
+		"UnknownFlagValue":   {[]string{"--future-flag=true", "-Xvalue"}, ""},
+		"UnknownLongFlag":    {[]string{"--future-flag", "-d"}, "must be passed with its value as --future-flag=<value>"},
+		"UnknownShortFlag":   {[]string{"-X", "-d"}, "must be passed with its value as -X<value>"},
+		"MissingValue":       {[]string{"--label"}, "extra argument --label is missing its value"},
+		"Image":              {[]string{"quay.io/evil:latest"}, "extra argument quay.io/evil:latest is not allowed"},
+		"ImageAfterBoolean":  {[]string{"--privileged", "quay.io/evil:latest"}, "podman would take it as the image"},
+		"EndOfFlags":         {[]string{"--"}, "extra argument -- is not allowed"},
+		"RootFS":             {[]string{"--rootfs"}, "as a root filesystem path on the host"},
+		"Attach":             {[]string{"-a", "stdin"}, "extra argument -a is not allowed"},
+		"Interactive":        {[]string{"--interactive=false"}, "extra argument --interactive=false is not allowed"},
+		"Detach":             {[]string{"-d"}, "extra argument -d is not allowed"},
+		"CombinedShortFlags": {[]string{"-Pit"}, "extra argument -Pit is not allowed"},
+		"TTY":                {[]string{"--tty"}, "a TTY would corrupt the plugin communication"},
+		"Name":               {[]string{"--name", "plugin"}, "use podman -> containerNamePrefix instead"},
+		"Remove":             {[]string{"--rm"}, "the deployer removes the containers"},
+		"StopSignal":         {[]string{"--stop-signal=SIGINT"}, "use deployment -> stopSignal instead"},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			config := &Config{Deployment: Deployment{
+				ExtraArgs:       scenario.extraArgs,
+				ImagePullPolicy: ImagePullPolicyIfNotPresent,
+			}}
+			err := config.Validate()
+			if scenario.expectedErrMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), scenario.expectedErrMsg)
+			}
+		})
+	}
+}
+
+var mountsTemplate = `
+{
+   "podman":{
+      "path":"%s"
+   },
+   "deployment":{
+      "mounts":[
+         {"type":"bind","source":"/srv/data:2024","target":"/data","readOnly":true,"relabel":"private","propagation":"rslave"},
+         {"type":"bind","source":"/srv/a,b","target":"/input"},
+         {"type":"bind","source":"C:\\Users\\plugin","target":"/home"},
+         {"type":"volume","source":"cache","target":"/cache"},
+         {"type":"tmpfs","target":"/scratch","size":"64MB"},
+         {"type":"image","source":"quay.io/arcalot/models:1","target":"/models"}
+      ]
+   }
+}
+`
+
+func TestMountsArgs(t *testing.T) {
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exec cat"))
+	connector, _ := getConnector(t, fmt.Sprintf(mountsTemplate, podmanPath))
+	plugin := assert.NoErrorR[deployer.Plugin](t)(connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin"))
+	t.Cleanup(func() { assert.NoError(t, plugin.Close()) })
+
+	runArgs := getRunInvocation(t, invocationLog)
+	assert.Contains(t, runArgs,
+		"--mount type=bind,source=/srv/data:2024,target=/data,readonly=true,relabel=private,bind-propagation=rslave")
+	assert.Contains(t, runArgs, `--mount type=bind,"source=/srv/a,b",target=/input`)
+	assert.Contains(t, runArgs, `--mount type=bind,source=C:\Users\plugin,target=/home`)
+	assert.Contains(t, runArgs, "--mount type=volume,source=cache,target=/cache")
+	assert.Contains(t, runArgs, "--mount type=tmpfs,target=/scratch,tmpfs-size=67108864")
+	assert.Contains(t, runArgs, "--mount type=image,source=quay.io/arcalot/models:1,target=/models")
+}
+
+func TestMountsValidation(t *testing.T) {
+	scenarios := map[string]struct {
+		mounts         []Mount
+		expectedErrMsg string
+	}{
+		"Bind":               {[]Mount{{Type: MountTypeBind, Source: "/data", Target: "/data", Relabel: MountRelabelShared}}, ""},
+		"Tmpfs":              {[]Mount{{Type: MountTypeTmpfs, Target: "/tmp", Size: 1024}}, ""},
+		"RelativeTarget":     {[]Mount{{Type: MountTypeVolume, Source: "cache", Target: "cache"}}, "target"},
+		"RelativeBindSource": {[]Mount{{Type: MountTypeBind, Source: "data", Target: "/data"}}, "must be an absolute path"},
+		"MissingSource":      {[]Mount{{Type: MountTypeVolume, Target: "/cache"}}, "requires a source"},
+		"TmpfsSource":        {[]Mount{{Type: MountTypeTmpfs, Source: "/tmp", Target: "/tmp"}}, "cannot have a source"},
+		"VolumeRelabel": {
+			[]Mount{{Type: MountTypeVolume, Source: "cache", Target: "/cache", Relabel: MountRelabelPrivate}},
+			"cannot be relabeled",
+		},
+		"TmpfsPropagation": {[]Mount{{Type: MountTypeTmpfs, Target: "/tmp", Propagation: "rshared"}}, "cannot set the propagation"},
+		"BindSize":         {[]Mount{{Type: MountTypeBind, Source: "/data", Target: "/data", Size: 1024}}, "cannot set a size"},
+		"UnknownType":      {[]Mount{{Type: "overlay", Source: "/data", Target: "/data"}}, "type"},
+		"DuplicateTarget": {
+			[]Mount{{Type: MountTypeTmpfs, Target: "/data"}, {Type: MountTypeVolume, Source: "data", Target: "/data"}},
+			"multiple mounts have the target /data",
+		},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			config := &Config{Deployment: Deployment{
+				Mounts:          scenario.mounts,
+				ImagePullPolicy: ImagePullPolicyIfNotPresent,
+			}}
+			err := config.Validate()
+			if scenario.expectedErrMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), scenario.expectedErrMsg)
+			}
+		})
+	}
+}
+
+func TestDeployRejectsInvalidEntries(t *testing.T) {
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exec cat"))
+	connector := assert.NoErrorR[deployer.Connector](t)(NewFactory().Create(&Config{
+		Podman: Podman{Path: podmanPath},
+		Deployment: Deployment{
+			ContainerConfig: &container.Config{Env: []string{"TOKEN=YWJj==", "=orphan", "HTTPS_PROXY"}},
+			HostConfig:      &container.HostConfig{Binds: []string{"/data:/data:ro,z", "/srv/data:2024:/data"}},
+			ImagePullPolicy: ImagePullPolicyNever,
+		},
+	}, log.NewTestLogger(t)))
+
+	_, err := connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `environment variable "=orphan" has no name`)
+	assert.Contains(t, err.Error(), `bind "/srv/data:2024:/data" must have an absolute target path`)
+	assert.Equals(t, strings.Contains(err.Error(), "TOKEN"), false)
+	// The container must not be run with a partial configuration.
+	for _, invocation := range tests.GetFakePodmanInvocations(t, invocationLog) {
+		assert.Equals(t, strings.HasPrefix(invocation, "run "), false)
+	}
+}
+
+var envPassthroughTemplate = `
+{
+   "podman":{
+      "path":"%s"
+   },
+   "deployment":{
+      "container":{
+         "Env":["TOKEN=YWJj==", "HTTPS_PROXY"]
+      }
+   }
+}
+`
+
+func TestEnvValueWithEqualsAndInherited(t *testing.T) {
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exec cat"))
+	connector, _ := getConnector(t, fmt.Sprintf(envPassthroughTemplate, podmanPath))
+	plugin := assert.NoErrorR[deployer.Plugin](t)(connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin"))
+	t.Cleanup(func() { assert.NoError(t, plugin.Close()) })
+
+	runArgs := getRunInvocation(t, invocationLog)
+	assert.Contains(t, runArgs, "-e TOKEN=YWJj==")
+	assert.Contains(t, runArgs, "-e HTTPS_PROXY ")
+}
+
+var envFilesTemplate = `
+{
+   "podman":{
+      "path":"%s"
+   },
+   "deployment":{
+      "container":{
+         "Env":["SHARED=config"]
+      },
+      "envFiles":["%s", "%s"],
+      "envPassthrough":["PLUGIN_TEST_FORWARD_*", "PLUGIN_TEST_SINGLE"]
+   }
+}
+`
+
+func TestEnvFilesAndPassthrough(t *testing.T) {
+	dir := t.TempDir()
+	envFile1 := filepath.Join(dir, "first.env")
+	envFile2 := filepath.Join(dir, "second.env")
+	assert.NoError(t, os.WriteFile(envFile1, []byte("# Credentials\nTOKEN=YWJj==\n\n  SHARED=file\nINHERITED\n"), 0600))
+	assert.NoError(t, os.WriteFile(envFile2, []byte("DSN=host=db user=plugin\n"), 0600))
+	t.Setenv("PLUGIN_TEST_FORWARD_A", "forwarded")
+	t.Setenv("PLUGIN_TEST_SINGLE", "single")
+	t.Setenv("PLUGIN_TEST_OTHER", "not forwarded")
+
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exec cat"))
+	connector, _ := getConnector(t, fmt.Sprintf(envFilesTemplate, podmanPath, envFile1, envFile2))
+	plugin := assert.NoErrorR[deployer.Plugin](t)(connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin"))
+	t.Cleanup(func() { assert.NoError(t, plugin.Close()) })
+
+	runArgs := getRunInvocation(t, invocationLog)
+	// The env files come first, so that the forwarded and configured variables take precedence.
+	assert.Contains(t, runArgs, "-e TOKEN=YWJj== -e SHARED=file -e INHERITED -e DSN=host=db user=plugin")
+	assert.Contains(t, runArgs, "-e PLUGIN_TEST_FORWARD_A=forwarded")
+	assert.Contains(t, runArgs, "-e PLUGIN_TEST_SINGLE=single")
+	assert.Contains(t, runArgs, "-e SHARED=config")
+	assert.Equals(t, strings.Index(runArgs, "-e SHARED=file") < strings.Index(runArgs, "-e SHARED=config"), true)
+	assert.Equals(t, strings.Contains(runArgs, "PLUGIN_TEST_OTHER"), false)
+}
+
+func TestEnvFilesInvalid(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "invalid.env")
+	assert.NoError(t, os.WriteFile(envFile, []byte("VALID=1\n=s3cr3t\nMY VAR=hunter2\n"), 0600))
+
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exec cat"))
+	connector, _ := getConnector(t, fmt.Sprintf(envFilesTemplate, podmanPath, envFile, filepath.Join(dir, "missing.env")))
+	_, err := connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid.env line 2: variable has no name")
+	assert.Contains(t, err.Error(), `invalid.env line 3: variable name "MY VAR" contains whitespace`)
+	assert.Contains(t, err.Error(), "missing.env")
+	assert.Equals(t, strings.Contains(err.Error(), "s3cr3t"), false)
+	assert.Equals(t, strings.Contains(err.Error(), "hunter2"), false)
+	for _, invocation := range tests.GetFakePodmanInvocations(t, invocationLog) {
+		assert.Equals(t, strings.HasPrefix(invocation, "run "), false)
+	}
+}
+
+func TestEnvPassthroughValidation(t *testing.T) {
+	config := &Config{Deployment: Deployment{
+		EnvPassthrough:  []string{"AWS_[A-Z"},
+		ImagePullPolicy: ImagePullPolicyIfNotPresent,
+	}}
+	err := config.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid environment variable passthrough pattern "AWS_[A-Z"`)
+}
+
+func TestSensitivePatternsValidation(t *testing.T) {
+	config := &Config{
+		Podman:     Podman{SensitivePatterns: []string{`token=(\S+`}},
+		Deployment: Deployment{ImagePullPolicy: ImagePullPolicyIfNotPresent},
+	}
+	err := config.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid sensitive pattern "token=(\\S+"`)
+}
+
+var connectionTemplate = `
+{
+   "podman":{
+      "path":"%s",
+      "connectionName":"engine"
+   },
+   "deployment":{
+      "connectionName":"%s"
+   }
+}
+`
+
+func TestDeploymentConnectionName(t *testing.T) {
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exec sleep 30"))
+	connector, _ := getConnector(t, fmt.Sprintf(connectionTemplate, podmanPath, "plugins"))
+	plugin := assert.NoErrorR[deployer.Plugin](t)(connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin"))
+	assert.NoError(t, plugin.Close())
+
+	invocations := tests.GetFakePodmanInvocations(t, invocationLog)
+	for _, subcommand := range []string{"pull ", "run ", "kill ", "rm "} {
+		assert.SliceContainsMatch(t, func(invocation string) bool {
+			return strings.HasPrefix(invocation, "--connection=plugins "+subcommand)
+		}, invocations)
+	}
+	// The connection of the podman configuration is overridden for every command.
+	for _, invocation := range invocations {
+		assert.Equals(t, strings.HasPrefix(invocation, "--connection=plugins "), true)
+	}
+}
+
+func TestDeploymentConnectionNameReusesWrapper(t *testing.T) {
+	podmanPath, _ := tests.CreateFakePodman(t, fakePodmanDeployScript("exec cat"))
+	connector, _ := getConnector(t, fmt.Sprintf(connectionTemplate, podmanPath, "plugins"))
+	podmanConnector := connector.(*Connector)
+	wrapper := podmanConnector.wrapper()
+	assert.Equals(t, podmanConnector.wrapper(), wrapper)
+	assert.Equals(t, len(podmanConnector.connectionWrappers), 1)
+	assert.Equals(t, wrapper == podmanConnector.podmanCliWrapper, false)
+}
+
+var urlTemplate = `
+{
+   "podman":{
+      "path":"%s",
+      "url":"ssh://core@engine.example.com:22/run/podman/podman.sock",
+      "identity":"/home/runner/.ssh/id_ed25519"
+   }
+}
+`
+
+func TestURLAndIdentity(t *testing.T) {
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exec sleep 30"))
+	connector, _ := getConnector(t, fmt.Sprintf(urlTemplate, podmanPath))
+	plugin := assert.NoErrorR[deployer.Plugin](t)(connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin"))
+	assert.NoError(t, plugin.Close())
+
+	connectionArgs := "--url=ssh://core@engine.example.com:22/run/podman/podman.sock --identity=/home/runner/.ssh/id_ed25519 "
+	invocations := tests.GetFakePodmanInvocations(t, invocationLog)
+	for _, subcommand := range []string{"pull ", "run ", "kill ", "rm "} {
+		assert.SliceContainsMatch(t, func(invocation string) bool {
+			return strings.HasPrefix(invocation, connectionArgs+subcommand)
+		}, invocations)
+	}
+}
+
+func TestURLValidation(t *testing.T) {
+	connectionName := "remote"
+	scenarios := map[string]struct {
+		podman         Podman
+		expectedErrMsg string
+	}{
+		"UnixURL":     {Podman{URL: "unix:///run/podman/podman.sock"}, ""},
+		"SSHIdentity": {Podman{URL: "ssh://core@engine.lab/run/podman/podman.sock", Identity: "/root/.ssh/id_rsa"}, ""},
+		"HTTPURL":     {Podman{URL: "http://engine.lab:8080"}, "url"},
+		"URLAndConnection": {
+			Podman{URL: "tcp://engine.lab:8080", ConnectionName: &connectionName},
+			"connectionName",
+		},
+		"IdentityWithoutSSH": {
+			Podman{URL: "tcp://engine.lab:8080", Identity: "/root/.ssh/id_rsa"},
+			"the identity is only used with an ssh:// url",
+		},
+		"APIBackend": {
+			Podman{Backend: BackendAPI, APIURL: "tcp://engine.lab:8080", URL: "tcp://engine.lab:8080"},
+			"the url and identity are only used by the cli backend",
+		},
+	}
+	for name, s := range scenarios {
+		t.Run(name, func(t *testing.T) {
+			config := &Config{Podman: s.podman, Deployment: Deployment{ImagePullPolicy: ImagePullPolicyIfNotPresent}}
+			err := config.Validate()
+			if s.expectedErrMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), s.expectedErrMsg)
+			}
+		})
+	}
+
+	config := &Config{
+		Podman:     Podman{URL: "tcp://engine.lab:8080"},
+		Deployment: Deployment{ImagePullPolicy: ImagePullPolicyIfNotPresent, ConnectionName: &connectionName},
+	}
+	err := config.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "the deployment connectionName and the podman url are mutually exclusive")
+}
+
+func TestBackendValidation(t *testing.T) {
+	connectionName := "remote"
+	scenarios := map[string]struct {
+		podman         Podman
+		expectedErrMsg string
+	}{
+		"CLI":           {Podman{Backend: BackendCLI}, ""},
+		"APIUnixSocket": {Podman{Backend: BackendAPI, APIURL: "unix:///run/podman/podman.sock"}, ""},
+		"APITCP":        {Podman{Backend: BackendAPI, APIURL: "tcp://localhost:8080"}, ""},
+		"APIWithoutURL": {Podman{Backend: BackendAPI}, "the api backend requires the apiURL"},
+		"CLIWithURL":    {Podman{Backend: BackendCLI, APIURL: "tcp://localhost:8080"}, "the apiURL is only used by the api backend"},
+		"APIWithConnection": {
+			Podman{Backend: BackendAPI, APIURL: "tcp://localhost:8080", ConnectionName: &connectionName},
+			"the connectionName is only used by the cli backend",
+		},
+		"APIWithSSH": {Podman{Backend: BackendAPI, APIURL: "ssh://core@engine.lab/run/podman/podman.sock"}, "apiURL"},
+	}
+	for name, s := range scenarios {
+		t.Run(name, func(t *testing.T) {
+			config := &Config{Podman: s.podman, Deployment: Deployment{ImagePullPolicy: ImagePullPolicyIfNotPresent}}
+			err := config.Validate()
+			if s.expectedErrMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), s.expectedErrMsg)
+			}
+		})
+	}
+}
+
+func TestAPIBackendRejectsDeploymentConnection(t *testing.T) {
+	connectionName := "plugins"
+	config := &Config{
+		Podman:     Podman{Backend: BackendAPI, APIURL: "unix:///run/podman/podman.sock"},
+		Deployment: Deployment{ImagePullPolicy: ImagePullPolicyIfNotPresent, ConnectionName: &connectionName},
+	}
+	err := config.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "the deployment connectionName is only used by the cli backend")
+}
+
+// startFakeAPIService serves the version and info endpoints of the libpod API
+// on a unix socket, returning the URL of the socket.
+func startFakeAPIService(t *testing.T, version string) string {
+	dir, err := os.MkdirTemp("", "podman-api")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "podman.sock")
+	listener, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v4.0.0/libpod/version", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"Version":%q}`, version)
+	})
+	mux.HandleFunc("/v4.0.0/libpod/info", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"host":{"cgroupVersion":"v2","security":{"rootless":false}},"version":{"Version":%q}}`, version)
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { _ = server.Close() })
+	return "unix://" + socket
+}
+
+func TestAPIBackendDoesNotNeedPodmanBinary(t *testing.T) {
+	apiURL := startFakeAPIService(t, "5.0.2")
+	var config any
+	assert.NoError(t, json.Unmarshal([]byte(fmt.Sprintf(
+		`{"podman":{"path":"/nonexistent/podman","backend":"api","apiURL":%q}}`,
+		apiURL,
+	)), &config))
+	factory := NewFactory()
+	unserializedConfig, err := factory.ConfigurationSchema().UnserializeType(config)
+	assert.NoError(t, err)
+	assert.Equals(t, unserializedConfig.Podman.Backend, BackendAPI)
+	connector, err := factory.Create(unserializedConfig, log.NewTestLogger(t))
+	assert.NoError(t, err)
+	assert.Equals(t, connector.(*Connector).Capabilities(), Capabilities{ServerVersion: "5.0.2", CgroupVersion: "v2"})
+}
+
+func TestCapabilities(t *testing.T) {
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exec cat"))
+	connector, _ := getConnector(t, fmt.Sprintf(connectionTemplate, podmanPath, "plugins"))
+	assert.Equals(t, connector.(*Connector).Capabilities(), Capabilities{
+		ClientVersion:  "4.9.3",
+		ServerVersion:  "4.9.3",
+		Rootless:       true,
+		CgroupVersion:  "v2",
+		OCIRuntime:     "crun",
+		NetworkBackend: "netavark",
+	})
+	// The capabilities are detected on the connection the deployments use.
+	assert.Equals(t, tests.GetFakePodmanInvocations(t, invocationLog), []string{
+		"--connection=plugins version --format json",
+		"--connection=plugins info --format json",
+	})
+}
+
+func TestMinimumVersion(t *testing.T) {
+	scenarios := map[string]struct {
+		clientVersion  string
+		serverVersion  string
+		minimumVersion string
+		expectedErrMsg string
+	}{
+		"Default":           {"4.9.3", "4.9.3", "", ""},
+		"PreRelease":        {"5.1.0-dev", "5.1.0-dev", "5.1", ""},
+		"OldClient":         {"3.4.4", "4.9.3", "", "the podman CLI has version 3.4.4, but the deployer requires version 4.0.0 or later"},
+		"OldServer":         {"5.0.2", "4.6.1", "5.0", "the podman service has version 4.6.1, but the deployer requires version 5.0.0 or later"},
+		"UnparsableVersion": {"4.9.3", "unknown", "", `failed to parse the version of the podman service (invalid version "unknown")`},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			podmanPath, _ := tests.CreateFakePodmanHost(
+				t,
+				fmt.Sprintf(`{"Client":{"Version":%q}}`, scenario.clientVersion),
+				fmt.Sprintf(`{"host":{"cgroupVersion":"v2"},"version":{"Version":%q}}`, scenario.serverVersion),
+				"",
+			)
+			podmanConfig := map[string]any{"path": podmanPath}
+			if scenario.minimumVersion != "" {
+				podmanConfig["minimumVersion"] = scenario.minimumVersion
+			}
+			factory := NewFactory()
+			unserializedConfig, err := factory.ConfigurationSchema().UnserializeType(map[string]any{"podman": podmanConfig})
+			assert.NoError(t, err)
+			_, err = factory.Create(unserializedConfig, log.NewTestLogger(t))
+			if scenario.expectedErrMsg == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), scenario.expectedErrMsg)
+		})
+	}
+}
+
+func TestMinimumVersionValidation(t *testing.T) {
+	config := &Config{Podman: Podman{MinimumVersion: "4.x"}, Deployment: Deployment{ImagePullPolicy: ImagePullPolicyIfNotPresent}}
+	err := config.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "minimumVersion")
+}
+
+var pastaTemplate = `
+{
+   "podman":{
+      "path":"%s"
+   },
+   "deployment":{
+      "host":{
+         "NetworkMode":"pasta"
+      }
+   }
+}
+`
+
+func TestUnsupportedOptionsRejected(t *testing.T) {
+	scenarios := map[string]struct {
+		info           string
+		configJSON     string
+		expectedErrMsg string
+	}{
+		"ResourceLimitsRootlessCgroupV1": {
+			`{"host":{"cgroupVersion":"v1","security":{"rootless":true}},"version":{"Version":"4.9.3"}}`,
+			resourceLimitsTemplate,
+			"the memory limit is not supported by rootless podman on cgroup v1 hosts",
+		},
+		"PastaOldPodman": {
+			`{"host":{"cgroupVersion":"v2","security":{"rootless":true}},"version":{"Version":"4.3.1"}}`,
+			pastaTemplate,
+			"network mode pasta requires podman 4.4.0 or later; the podman service has version 4.3.1",
+		},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			podmanPath, invocationLog := tests.CreateFakePodmanHost(
+				t,
+				`{"Client":{"Version":"4.9.3"}}`,
+				scenario.info,
+				fakePodmanDeployScript("exec cat"),
+			)
+			connector, _ := getConnector(t, fmt.Sprintf(scenario.configJSON, podmanPath))
+			_, err := connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin")
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), "invalid plugin container configuration")
+			assert.Contains(t, err.Error(), scenario.expectedErrMsg)
+			for _, invocation := range tests.GetFakePodmanInvocations(t, invocationLog) {
+				assert.Equals(t, strings.HasPrefix(invocation, "run "), false)
+			}
+		})
+	}
+}
+
+var secretsTemplate = `
+{
+   "podman":{
+      "path":"%s"
+   },
+   "deployment":{
+      "secrets":[
+         {"name":"api_token","value":"s3cr3t-t0ken","type":"env","target":"API_TOKEN"},
+         {"name":"kubeconfig","file":"%s"}
+      ]
+   }
+}
+`
+
+func TestSecrets(t *testing.T) {
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exec cat"))
+	secretFile := filepath.Join(t.TempDir(), "kubeconfig")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("apiVersion: v1\n"), 0o600))
+	connector, _ := getConnector(t, fmt.Sprintf(secretsTemplate, podmanPath, secretFile))
+	plugin := assert.NoErrorR[deployer.Plugin](t)(connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin"))
+	containerName := plugin.ID()
+
+	// The values are passed through stdin rather than on the command line.
+	dir := filepath.Dir(podmanPath)
+	tokenSecret := containerName + "_api_token"
+	kubeconfigSecret := containerName + "_kubeconfig"
+	assert.Equals(t, string(assert.NoErrorR[[]byte](t)(os.ReadFile(filepath.Join(dir, "secret_"+tokenSecret)))), "s3cr3t-t0ken")
+	assert.Equals(t, string(assert.NoErrorR[[]byte](t)(os.ReadFile(filepath.Join(dir, "secret_"+kubeconfigSecret)))), "apiVersion: v1\n")
+	invocations := tests.GetFakePodmanInvocations(t, invocationLog)
+	assert.SliceContains(t, "secret create "+tokenSecret+" -", invocations)
+	assert.Equals(t, strings.Contains(strings.Join(invocations, "\n"), "s3cr3t-t0ken"), false)
+
+	runArgs := getRunInvocation(t, invocationLog)
+	assert.Contains(t, runArgs, "--secret "+tokenSecret+",type=env,target=API_TOKEN")
+	assert.Contains(t, runArgs, "--secret "+kubeconfigSecret+",type=mount,target=kubeconfig")
+
+	assert.NoError(t, plugin.Close())
+	invocations = tests.GetFakePodmanInvocations(t, invocationLog)
+	removeContainer := assert.SliceContains(t, "rm --force "+containerName, invocations)
+	// The secrets are removed after the container.
+	assert.Equals(t, assert.SliceContains(t, "secret rm "+tokenSecret, invocations) > removeContainer, true)
+	assert.Equals(t, assert.SliceContains(t, "secret rm "+kubeconfigSecret, invocations) > removeContainer, true)
+}
+
+func TestSecretsRemovedWhenDeployFails(t *testing.T) {
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exit 125"))
+	// The container never starts.
+	assert.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(podmanPath), "no_such_container"), nil, 0o600))
+	secretFile := filepath.Join(t.TempDir(), "kubeconfig")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("apiVersion: v1\n"), 0o600))
+	connector, _ := getConnector(t, fmt.Sprintf(secretsTemplate, podmanPath, secretFile))
+	_, err := connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin")
+	assert.Error(t, err)
+
+	var removed []string
+	for _, invocation := range tests.GetFakePodmanInvocations(t, invocationLog) {
+		if strings.HasPrefix(invocation, "secret rm ") {
+			removed = append(removed, invocation)
+		}
+	}
+	assert.Equals(t, len(removed), 2)
+}
+
+func TestSecretsMissingFile(t *testing.T) {
+	podmanPath, invocationLog := tests.CreateFakePodman(t, fakePodmanDeployScript("exec cat"))
+	missingFile := filepath.Join(t.TempDir(), "missing")
+	connector, _ := getConnector(t, fmt.Sprintf(secretsTemplate, podmanPath, missingFile))
+	_, err := connector.Deploy(context.Background(), "quay.io/arcalot/fake-plugin")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read the file of secret kubeconfig")
+
+	// The secret created before the failure is removed again and the container is not run.
+	invocations := tests.GetFakePodmanInvocations(t, invocationLog)
+	created := slices.IndexFunc(invocations, func(invocation string) bool { return strings.HasPrefix(invocation, "secret create ") })
+	assert.Equals(t, created >= 0, true)
+	tokenSecret := strings.Fields(invocations[created])[2]
+	assert.SliceContains(t, "secret rm "+tokenSecret, invocations)
+	assert.Equals(t, slices.ContainsFunc(invocations, func(invocation string) bool { return strings.HasPrefix(invocation, "run ") }), false)
+}
+
+func TestSecretsValidation(t *testing.T) {
+	scenarios := map[string]struct {
+		secrets        []Secret
+		expectedErrMsg string
+	}{
+		"Value":        {[]Secret{{Name: "token", Value: "s3cr3t"}}, ""},
+		"FileEnv":      {[]Secret{{Name: "token", File: "/etc/token", Type: SecretTypeEnv, Target: "TOKEN"}}, ""},
+		"NoValue":      {[]Secret{{Name: "token"}}, "requires either a value or a file"},
+		"ValueAndFile": {[]Secret{{Name: "token", Value: "s3cr3t", File: "/etc/token"}}, "cannot have both a value and a file"},
+		"InvalidName":  {[]Secret{{Name: "api token", Value: "s3cr3t"}}, "name"},
+		"InvalidEnv": {
+			[]Secret{{Name: "token", Value: "s3cr3t", Type: SecretTypeEnv, Target: "API-TOKEN"}},
+			`cannot be exposed as the environment variable "API-TOKEN"`,
+		},
+		"DuplicateName": {
+			[]Secret{{Name: "token", Value: "s3cr3t"}, {Name: "token", File: "/etc/token"}},
+			"multiple secrets have the name token",
+		},
+	}
+	for name, s := range scenarios {
+		t.Run(name, func(t *testing.T) {
+			config := &Config{Deployment: Deployment{Secrets: s.secrets, ImagePullPolicy: ImagePullPolicyIfNotPresent}}
+			err := config.Validate()
+			if s.expectedErrMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), s.expectedErrMsg)
+			}
+		})
+	}
+}
+
+// configWithHost returns a valid configuration using the host configuration.
+func configWithHost(hostConfig *container.HostConfig) *Config {
+	// The schema only accepts set network and cgroup namespace modes.
+	if hostConfig.NetworkMode == "" {
+		hostConfig.NetworkMode = "bridge"
+	}
+	if hostConfig.CgroupnsMode == "" {
+		hostConfig.CgroupnsMode = "private"
+	}
+	return &Config{Deployment: Deployment{HostConfig: hostConfig, ImagePullPolicy: ImagePullPolicyIfNotPresent}}
+}
+
+func TestHostConfigValidation(t *testing.T) {
+	scenarios := map[string]struct {
+		hostConfig container.HostConfig
+		valid      bool
+	}{
+		"CapAdd":                 {container.HostConfig{CapAdd: []string{"NET_RAW", "CAP_NET_ADMIN"}}, true},
+		"CapDropAll":             {container.HostConfig{CapDrop: []string{"ALL"}}, true},
+		"CapAddLowercase":        {container.HostConfig{CapAdd: []string{"net_raw"}}, false},
+		"CapAddSpace":            {container.HostConfig{CapAdd: []string{"NET RAW"}}, false},
+		"CapAddUnknown":          {container.HostConfig{CapAdd: []string{"NET_RAWW"}}, false},
+		"CapDropUnknownPrefixed": {container.HostConfig{CapDrop: []string{"CAP_FOO"}}, false},
+		"CapAddNewest":           {container.HostConfig{CapAdd: []string{"CAP_CHECKPOINT_RESTORE", "BPF"}}, true},
+		"DNSIPv4":                {container.HostConfig{DNS: []string{"10.0.0.53"}}, true},
+		"DNSIPv6":                {container.HostConfig{DNS: []string{"fd00::53"}}, true},
+		"DNSHostname":            {container.HostConfig{DNS: []string{"dns.example.com"}}, false},
+		"DNSOptions":             {container.HostConfig{DNSOptions: []string{"ndots:2", "edns0"}}, true},
+		"DNSOptionsSpace":        {container.HostConfig{DNSOptions: []string{"ndots: 2"}}, false},
+		"DNSSearch":              {container.HostConfig{DNSSearch: []string{"lab.example.com", "."}}, true},
+		"DNSSearchInvalid":       {container.HostConfig{DNSSearch: []string{"lab example"}}, false},
+		"ExtraHostsIPv4":         {container.HostConfig{ExtraHosts: []string{"registry.lab:10.0.0.5"}}, true},
+		"ExtraHostsIPv6":         {container.HostConfig{ExtraHosts: []string{"registry.lab:fd00::5"}}, true},
+		"ExtraHostsGateway":      {container.HostConfig{ExtraHosts: []string{"gateway:host-gateway"}}, true},
+		"ExtraHostsMultipleName": {container.HostConfig{ExtraHosts: []string{"registry;registry.lab:10.0.0.5"}}, true},
+		"ExtraHostsMissingIP":    {container.HostConfig{ExtraHosts: []string{"registry.lab"}}, false},
+		"ExtraHostsHostnameIP":   {container.HostConfig{ExtraHosts: []string{"registry.lab:other.lab"}}, false},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			err := configWithHost(&scenario.hostConfig).Validate()
+			if scenario.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestContainerIdentity(t *testing.T) {
+	logger := log.NewTestLogger(t)
+	connector, config := getConnector(t, fmt.Sprintf(containerIdentityTemplate, "podman", "nobody"))
+	plugin := assert.NoErrorR[deployer.Plugin](t)(connector.Deploy(
+		context.Background(),
+		"quay.io/arcalot/podman-deployer-test-helper:0.1.0"))
+	t.Cleanup(func() { assert.NoError(t, plugin.Close()) })
+
+	assert.NoErrorR[int](t)(plugin.Write([]byte("sleep 5\n")))
+
+	// Wait for the container to start running; arbitrarily fail the test if it
+	// doesn't happen within 30 seconds.
+	end := time.Now().Add(30 * time.Second)
+	for !tests.IsContainerRunning(logger, config.Podman.Path, plugin.ID()) {
+		assert.Equals(t, time.Now().Before(end), true)
+		time.Sleep(1 * time.Second)
+	}
+	assert.Equals(t, tests.ExecInContainer(logger, config.Podman.Path, plugin.ID(), "hostname"), "plugin-host")
+	assert.Equals(t, tests.ExecInContainer(logger, config.Podman.Path, plugin.ID(), "id", "-un"), "nobody")
+	// Only the loopback interface exists without networking.
+	assert.Equals(t, tests.ExecInContainer(logger, config.Podman.Path, plugin.ID(), "ls", "/sys/class/net"), "lo")
+}
+
+var diagnosticsTemplate = `
+{
+   "podman":{
+      "path":"%s",
+      "url":"ssh://core@engine.lab/run/podman/podman.sock"
+   },
+   "deployment":{
+      "host":{
+         "Binds":["/data:/data:ro,Z","/cache:/cache"]
+      }
+   }
+}
+`
+
+// getDiagnosticsConnector creates a connector for a remote podman whose podman info reports the host.
+func getDiagnosticsConnector(t *testing.T, host string) *Connector {
+	podmanPath, _ := tests.CreateFakePodmanHost(
+		t,
+		`{"Client":{"Version":"5.0.2"},"Server":{"Version":"4.9.3"}}`,
+		`{"host":`+host+`,"store":{"graphDriverName":"overlay","graphStatus":{"Backing Filesystem":"xfs","Supports d_type":"true"}},`+
+			`"version":{"Version":"4.9.3"}}`,
+		"",
+	)
+	connector, _ := getConnector(t, fmt.Sprintf(diagnosticsTemplate, podmanPath))
+	return connector.(*Connector)
+}
+
+func TestDiagnoseHealthy(t *testing.T) {
+	connector := getDiagnosticsConnector(t, `{
+		"cgroupVersion":"v2",
+		"cgroupControllers":["cpu","io","memory","pids"],
+		"networkBackend":"netavark",
+		"security":{"rootless":true,"selinuxEnabled":false},
+		"idMappings":{
+			"uidmap":[{"container_id":0,"host_id":1000,"size":1},{"container_id":1,"host_id":100000,"size":65536}],
+			"gidmap":[{"container_id":0,"host_id":1000,"size":1},{"container_id":1,"host_id":100000,"size":65536}]
+		}
+	}`)
+	report := connector.Diagnose(context.Background())
+	assert.Equals(t, report.Healthy(), true)
+	assert.Equals(t, report.Checks, []DiagnosticCheck{
+		{Name: "reachability", Status: DiagnosticOK, Message: "podman 4.9.3 is reachable through podman CLI 5.0.2"},
+		{Name: "rootless", Status: DiagnosticOK, Message: "rootless podman has 65536 subordinate UIDs and 65536 subordinate GIDs"},
+		{Name: "cgroups", Status: DiagnosticOK, Message: "the host uses cgroup v2"},
+		{Name: "storage", Status: DiagnosticOK, Message: "the overlay storage driver is backed by xfs"},
+		{Name: "selinux", Status: DiagnosticOK, Message: "SELinux is disabled on the podman host"},
+		{Name: "network", Status: DiagnosticOK, Message: "podman uses the netavark network backend"},
+	})
+}
+
+func TestDiagnoseProblems(t *testing.T) {
+	connector := getDiagnosticsConnector(t, `{
+		"cgroupVersion":"v2",
+		"cgroupControllers":["cpu"],
+		"networkBackend":"cni",
+		"security":{"rootless":true,"selinuxEnabled":true},
+		"idMappings":{
+			"uidmap":[{"container_id":0,"host_id":1000,"size":1}],
+			"gidmap":[{"container_id":0,"host_id":1000,"size":1}]
+		}
+	}`)
+	report := connector.Diagnose(context.Background())
+	assert.Equals(t, report.Healthy(), false)
+	expected := map[string]struct {
+		status      DiagnosticStatus
+		message     string
+		remediation string
+	}{
+		"reachability": {DiagnosticOK, "is reachable", ""},
+		"rootless":     {DiagnosticError, "0 subordinate UIDs and 0 subordinate GIDs", "usermod --add-subuids"},
+		"cgroups":      {DiagnosticWarning, "the memory, pids controllers are not delegated", "Delegate="},
+		"storage":      {DiagnosticOK, "overlay", ""},
+		"selinux":      {DiagnosticWarning, "the binds /cache:/cache are not relabeled", "z (shared) or Z (private)"},
+		"network":      {DiagnosticWarning, "CNI network backend is deprecated", "netavark"},
+	}
+	assert.Equals(t, len(report.Checks), len(expected))
+	for _, check := range report.Checks {
+		e := expected[check.Name]
+		assert.Equals(t, check.Status, e.status)
+		assert.Contains(t, check.Message, e.message)
+		assert.Contains(t, check.Remediation, e.remediation)
+	}
+	assert.Contains(t, report.String(), "[error] rootless: rootless podman has 0 subordinate UIDs")
+}
+
+func TestDiagnoseHostChecks(t *testing.T) {
+	scenarios := map[string]struct {
+		check          func(info *cliwrapper.HostInfo) DiagnosticCheck
+		info           cliwrapper.HostInfo
+		expectedStatus DiagnosticStatus
+		expectedMsg    string
+	}{
+		"RootfulPodman": {diagnoseRootless, cliwrapper.HostInfo{}, DiagnosticOK, "podman runs as root"},
+		"FewSubordinateIDs": {
+			diagnoseRootless,
+			cliwrapper.HostInfo{
+				Rootless:    true,
+				UIDMappings: []cliwrapper.IDMapping{{ContainerID: 0, HostID: 1000, Size: 1}, {ContainerID: 1, HostID: 100000, Size: 1000}},
+				GIDMappings: []cliwrapper.IDMapping{{ContainerID: 0, HostID: 1000, Size: 1}, {ContainerID: 1, HostID: 100000, Size: 1000}},
+			},
+			DiagnosticWarning,
+			"only 1000 subordinate UIDs",
+		},
+		"RootlessCgroupV1": {diagnoseCgroups, cliwrapper.HostInfo{Rootless: true, CgroupVersion: "v1"}, DiagnosticWarning, "cannot apply resource limits"},
+		"RootfulCgroupV1":  {diagnoseCgroups, cliwrapper.HostInfo{CgroupVersion: "v1"}, DiagnosticOK, "cgroup v1"},
+		"VFS":              {diagnoseStorage, cliwrapper.HostInfo{StorageDriver: "vfs"}, DiagnosticWarning, "vfs storage driver"},
+		"NoDType": {
+			diagnoseStorage,
+			cliwrapper.HostInfo{StorageDriver: "overlay", StorageStatus: map[string]string{"Backing Filesystem": "xfs", "Supports d_type": "false"}},
+			DiagnosticError,
+			"the xfs backing filesystem of the overlay driver does not support d_type",
+		},
+		"UnlabeledBindMount": {
+			remoteMountsConnector([]Mount{
+				{Type: MountTypeBind, Source: "/srv/data", Target: "/data"},
+				{Type: MountTypeBind, Source: "/srv/cache", Target: "/cache", Relabel: MountRelabelPrivate},
+				{Type: MountTypeVolume, Source: "plugin-data", Target: "/var/lib/plugin"},
+			}).diagnoseSELinux,
+			cliwrapper.HostInfo{SELinuxEnabled: true},
+			DiagnosticWarning,
+			"the binds /srv/data:/data are not relabeled",
+		},
+		"RelabeledBindMount": {
+			remoteMountsConnector([]Mount{
+				{Type: MountTypeBind, Source: "/srv/data", Target: "/data", Relabel: MountRelabelShared},
+			}).diagnoseSELinux,
+			cliwrapper.HostInfo{SELinuxEnabled: true},
+			DiagnosticOK,
+			"SELinux is enabled on the podman host",
+		},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			check := scenario.check(&scenario.info)
+			assert.Equals(t, check.Status, scenario.expectedStatus)
+			assert.Contains(t, check.Message, scenario.expectedMsg)
+		})
+	}
+}
+
+// remoteMountsConnector returns a connector with the mounts for a remote podman, whose SELinux mode is not read from
+// the engine host.
+func remoteMountsConnector(mounts []Mount) *Connector {
+	return &Connector{config: &Config{
+		Podman:     Podman{URL: "ssh://core@engine.lab/run/podman/podman.sock"},
+		Deployment: Deployment{Mounts: mounts},
+	}}
+}
+
+func TestDiagnoseUnreachable(t *testing.T) {
+	connector := getDiagnosticsConnector(t, `{"cgroupVersion":"v2"}`)
+	connector.podmanCliWrapper = cliwrapper.NewCliWrapper(
+		"/nonexistent/podman",
+		log.NewTestLogger(t),
+		cliwrapper.Connection{},
+		cliwrapper.Timeouts{},
+		nil,
+	)
+	report := connector.Diagnose(context.Background())
+	assert.Equals(t, report.Healthy(), false)
+	assert.Equals(t, report.Checks[0].Name, "reachability")
+	assert.Equals(t, report.Checks[0].Status, DiagnosticError)
+	assert.Contains(t, report.Checks[0].Remediation, "podman system connection list")
+	for _, check := range report.Checks[1:] {
+		assert.Equals(t, check.Status, DiagnosticSkipped)
+	}
+}
@@ -0,0 +1,330 @@
+package podman
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/opencontainers/selinux/go-selinux"
+	"go.flow.arcalot.io/podmandeployer/internal/cliwrapper"
+)
+
+// DiagnosticStatus is the outcome of a diagnostic check.
+type DiagnosticStatus string
+
+const (
+	// DiagnosticOK means that the check found no problem.
+	DiagnosticOK DiagnosticStatus = "ok"
+	// DiagnosticWarning means that some deployments may fail or misbehave.
+	DiagnosticWarning DiagnosticStatus = "warning"
+	// DiagnosticError means that deployments fail.
+	DiagnosticError DiagnosticStatus = "error"
+	// DiagnosticSkipped means that the check could not run because podman is not reachable.
+	DiagnosticSkipped DiagnosticStatus = "skipped"
+)
+
+// DiagnosticCheck is the result of checking one aspect of the podman environment.
+type DiagnosticCheck struct {
+	// Name identifies the checked aspect, e.g. "cgroups".
+	Name    string           `json:"name"`
+	Status  DiagnosticStatus `json:"status"`
+	Message string           `json:"message"`
+	// Remediation hints how to fix the problem; empty if the check passed.
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// DiagnosticsReport is the result of the pre-flight checks of the podman environment.
+type DiagnosticsReport struct {
+	Checks []DiagnosticCheck `json:"checks"`
+}
+
+// Healthy reports whether no check failed with an error or was skipped.
+func (r DiagnosticsReport) Healthy() bool {
+	return !slices.ContainsFunc(r.Checks, func(check DiagnosticCheck) bool {
+		return check.Status == DiagnosticError || check.Status == DiagnosticSkipped
+	})
+}
+
+func (r DiagnosticsReport) String() string {
+	var b strings.Builder
+	for _, check := range r.Checks {
+		_, _ = fmt.Fprintf(&b, "[%s] %s: %s\n", check.Status, check.Name, check.Message)
+		if check.Remediation != "" {
+			_, _ = fmt.Fprintf(&b, "    %s\n", check.Remediation)
+		}
+	}
+	return b.String()
+}
+
+// Names of the diagnostic checks, in the order of the report.
+const (
+	diagnosticReachability = "reachability"
+	diagnosticRootless     = "rootless"
+	diagnosticCgroups      = "cgroups"
+	diagnosticStorage      = "storage"
+	diagnosticSELinux      = "selinux"
+	diagnosticNetwork      = "network"
+)
+
+// minimumSubordinateIDs is the number of subordinate IDs podman assigns by default, which covers the IDs used by
+// common images.
+const minimumSubordinateIDs = 65536
+
+// Diagnose checks the podman environment the connector deploys through, to pinpoint why deployments fail on a new
+// host: podman reachability, the rootless setup, cgroup delegation, the storage driver, SELinux and the network
+// backend. Problems are reported with remediation hints rather than returned as errors.
+func (c *Connector) Diagnose(ctx context.Context) DiagnosticsReport {
+	info, reachability := c.diagnoseReachability(ctx)
+	report := DiagnosticsReport{Checks: []DiagnosticCheck{reachability}}
+	if info == nil {
+		for _, name := range []string{diagnosticRootless, diagnosticCgroups, diagnosticStorage, diagnosticSELinux, diagnosticNetwork} {
+			report.Checks = append(report.Checks, DiagnosticCheck{
+				Name:    name,
+				Status:  DiagnosticSkipped,
+				Message: "podman is not reachable",
+			})
+		}
+		return report
+	}
+	report.Checks = append(
+		report.Checks,
+		diagnoseRootless(info),
+		diagnoseCgroups(info),
+		diagnoseStorage(info),
+		c.diagnoseSELinux(info),
+		diagnoseNetwork(info),
+	)
+	return report
+}
+
+// diagnoseReachability runs podman version and podman info, returning the host information if podman is reachable.
+func (c *Connector) diagnoseReachability(ctx context.Context) (*cliwrapper.HostInfo, DiagnosticCheck) {
+	check := DiagnosticCheck{Name: diagnosticReachability, Status: DiagnosticOK}
+	wrapper := c.wrapper()
+	version, err := wrapper.Version(ctx)
+	var info *cliwrapper.HostInfo
+	if err == nil {
+		info, err = wrapper.Info(ctx)
+	}
+	if err != nil {
+		check.Status = DiagnosticError
+		check.Message = err.Error()
+		check.Remediation = c.reachabilityRemediation()
+		return nil, check
+	}
+	check.Message = fmt.Sprintf("podman %s is reachable", info.Version)
+	if version.Client != "" && version.Client != info.Version {
+		check.Message += fmt.Sprintf(" through podman CLI %s", version.Client)
+	}
+	// The validation guarantees a valid minimum version.
+	minimumVersion, _ := c.config.Podman.minimumVersion()
+	err = checkMinimumVersion("service", info.Version, minimumVersion)
+	if err == nil && version.Client != "" {
+		err = checkMinimumVersion("CLI", version.Client, minimumVersion)
+	}
+	if err != nil {
+		check.Status = DiagnosticError
+		check.Message = err.Error()
+		check.Remediation = "Upgrade podman, or lower podman.minimumVersion if the older version is known to work."
+	}
+	return info, check
+}
+
+// reachabilityRemediation hints how to make the podman service of the connector reachable.
+func (c *Connector) reachabilityRemediation() string {
+	switch {
+	case c.config.Podman.Backend == BackendAPI:
+		return fmt.Sprintf(
+			"Check that the podman service listens on %s, e.g. start it with systemctl --user enable --now podman.socket.",
+			c.config.Podman.APIURL,
+		)
+	case !c.config.localPodman():
+		return "Check the connection with podman system connection list, and that the podman service runs on the " +
+			"remote host, e.g. with systemctl --user enable --now podman.socket."
+	default:
+		return "Check that podman is installed at podman.path and that podman info succeeds for the user running the " +
+			"engine."
+	}
+}
+
+func diagnoseRootless(info *cliwrapper.HostInfo) DiagnosticCheck {
+	check := DiagnosticCheck{Name: diagnosticRootless, Status: DiagnosticOK}
+	if !info.Rootless {
+		check.Message = "podman runs as root"
+		return check
+	}
+	subordinateUIDs := subordinateIDs(info.UIDMappings)
+	subordinateGIDs := subordinateIDs(info.GIDMappings)
+	remediation := "Assign subordinate ID ranges with usermod --add-subuids 100000-165535 --add-subgids 100000-165535 " +
+		"<user>, then run podman system migrate."
+	switch {
+	case subordinateUIDs == 0 || subordinateGIDs == 0:
+		check.Status = DiagnosticError
+		check.Message = fmt.Sprintf(
+			"rootless podman has %d subordinate UIDs and %d subordinate GIDs; images with files owned by other users "+
+				"than root cannot be used",
+			subordinateUIDs,
+			subordinateGIDs,
+		)
+		check.Remediation = remediation
+	case subordinateUIDs < minimumSubordinateIDs || subordinateGIDs < minimumSubordinateIDs:
+		check.Status = DiagnosticWarning
+		check.Message = fmt.Sprintf(
+			"rootless podman has only %d subordinate UIDs and %d subordinate GIDs; images with files owned by higher "+
+				"IDs cannot be used",
+			subordinateUIDs,
+			subordinateGIDs,
+		)
+		check.Remediation = remediation
+	default:
+		check.Message = fmt.Sprintf(
+			"rootless podman has %d subordinate UIDs and %d subordinate GIDs",
+			subordinateUIDs,
+			subordinateGIDs,
+		)
+	}
+	return check
+}
+
+// subordinateIDs counts the IDs of the mappings beyond the mapping of the root of the user namespace to the user.
+func subordinateIDs(mappings []cliwrapper.IDMapping) int {
+	count := 0
+	for _, mapping := range mappings {
+		if mapping.ContainerID != 0 {
+			count += mapping.Size
+		}
+	}
+	return count
+}
+
+// delegatedControllers are the cgroup controllers the resource limits of rootless podman need.
+var delegatedControllers = []string{"cpu", "memory", "pids"}
+
+func diagnoseCgroups(info *cliwrapper.HostInfo) DiagnosticCheck {
+	check := DiagnosticCheck{Name: diagnosticCgroups, Status: DiagnosticOK}
+	switch info.CgroupVersion {
+	case "v1":
+		check.Message = "the host uses cgroup v1"
+		if info.Rootless {
+			check.Status = DiagnosticWarning
+			check.Message += "; rootless podman cannot apply resource limits"
+			check.Remediation = "Boot the host with systemd.unified_cgroup_hierarchy=1 to switch to cgroup v2."
+		}
+	case "v2":
+		check.Message = "the host uses cgroup v2"
+		if !info.Rootless {
+			return check
+		}
+		var missing []string
+		for _, controller := range delegatedControllers {
+			if !slices.Contains(info.CgroupControllers, controller) {
+				missing = append(missing, controller)
+			}
+		}
+		if len(missing) > 0 {
+			check.Status = DiagnosticWarning
+			check.Message += fmt.Sprintf(
+				"; the %s controllers are not delegated to the user, so resource limits using them fail",
+				strings.Join(missing, ", "),
+			)
+			check.Remediation = "Delegate the controllers with Delegate=cpu cpuset io memory pids in " +
+				"/etc/systemd/system/user@.service.d/delegate.conf, then run systemctl daemon-reload and log in again."
+		}
+	default:
+		check.Status = DiagnosticWarning
+		check.Message = "podman did not report the cgroup version of the host"
+	}
+	return check
+}
+
+func diagnoseStorage(info *cliwrapper.HostInfo) DiagnosticCheck {
+	check := DiagnosticCheck{Name: diagnosticStorage, Status: DiagnosticOK}
+	backingFilesystem := info.StorageStatus["Backing Filesystem"]
+	switch {
+	case info.StorageDriver == "":
+		check.Status = DiagnosticWarning
+		check.Message = "podman did not report its storage driver"
+	case info.StorageDriver == "vfs":
+		check.Status = DiagnosticWarning
+		check.Message = "the vfs storage driver copies every image layer, which is slow and uses a lot of disk space"
+		check.Remediation = "Switch to the overlay driver in storage.conf (rootless podman needs kernel 5.13 or " +
+			"fuse-overlayfs), then run podman system reset."
+	case info.StorageDriver == "overlay" && info.StorageStatus["Supports d_type"] == "false":
+		check.Status = DiagnosticError
+		check.Message = fmt.Sprintf("the %s backing filesystem of the overlay driver does not support d_type", backingFilesystem)
+		check.Remediation = "Move the podman storage to a filesystem supporting d_type, e.g. xfs formatted with ftype=1."
+	case backingFilesystem != "":
+		check.Message = fmt.Sprintf("the %s storage driver is backed by %s", info.StorageDriver, backingFilesystem)
+	default:
+		check.Message = fmt.Sprintf("podman uses the %s storage driver", info.StorageDriver)
+	}
+	return check
+}
+
+// diagnoseSELinux checks whether SELinux may deny the plugin containers access to their binds. The enforcing mode is
+// only known for a local podman, whose host is the engine host.
+func (c *Connector) diagnoseSELinux(info *cliwrapper.HostInfo) DiagnosticCheck {
+	check := DiagnosticCheck{Name: diagnosticSELinux, Status: DiagnosticOK}
+	if !info.SELinuxEnabled {
+		check.Message = "SELinux is disabled on the podman host"
+		return check
+	}
+	check.Message = "SELinux is enabled on the podman host"
+	if c.config.localPodman() {
+		switch selinux.EnforceMode() {
+		case selinux.Enforcing:
+			check.Message = "SELinux is enforcing"
+		case selinux.Permissive:
+			check.Message = "SELinux is permissive; denials are only logged"
+			return check
+		}
+	}
+	var unlabeled []string
+	for _, bind := range c.unwrapHostConfig().Binds {
+		if !relabelsBind(bind) {
+			unlabeled = append(unlabeled, bind)
+		}
+	}
+	for _, mount := range c.config.Deployment.Mounts {
+		if mount.Type == MountTypeBind && mount.Relabel == "" {
+			unlabeled = append(unlabeled, mount.Source+":"+mount.Target)
+		}
+	}
+	if len(unlabeled) > 0 {
+		check.Status = DiagnosticWarning
+		check.Message += fmt.Sprintf(
+			"; the binds %s are not relabeled, so SELinux may deny the plugin access to them",
+			strings.Join(unlabeled, ", "),
+		)
+		check.Remediation = "Add the z (shared) or Z (private) option to the binds, set relabel on the bind mounts, " +
+			"or label the host directories with chcon -R -t container_file_t."
+	}
+	return check
+}
+
+// relabelsBind reports whether the options of the bind make podman relabel its source for SELinux.
+func relabelsBind(bind string) bool {
+	tokens := strings.Split(bind, ":")
+	if len(tokens) < 3 {
+		return false
+	}
+	options := strings.Split(tokens[len(tokens)-1], ",")
+	return slices.Contains(options, "z") || slices.Contains(options, "Z")
+}
+
+func diagnoseNetwork(info *cliwrapper.HostInfo) DiagnosticCheck {
+	check := DiagnosticCheck{Name: diagnosticNetwork, Status: DiagnosticOK}
+	switch info.NetworkBackend {
+	case "cni":
+		check.Status = DiagnosticWarning
+		check.Message = "the CNI network backend is deprecated and no longer supported by podman 5"
+		check.Remediation = `Switch to netavark with network_backend = "netavark" in the [network] table of ` +
+			"containers.conf, then run podman system reset."
+	case "":
+		check.Message = "podman did not report its network backend"
+	default:
+		check.Message = fmt.Sprintf("podman uses the %s network backend", info.NetworkBackend)
+	}
+	return check
+}
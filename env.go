@@ -0,0 +1,87 @@
+package podman
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// readEnvFiles reads the environment variables from the env files in order, so that later files override earlier
+// ones when passed to podman.
+func readEnvFiles(envFiles []string) ([]string, error) {
+	var env []string
+	var errs []error
+	for _, envFile := range envFiles {
+		fileEnv, err := readEnvFile(envFile)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		env = append(env, fileEnv...)
+	}
+	return env, errors.Join(errs...)
+}
+
+// readEnvFile parses an env file in the format of podman run --env-file: one KEY=value or KEY entry per line, with
+// empty lines and lines starting with # ignored. The values are taken verbatim, and are never part of the errors.
+func readEnvFile(envFile string) ([]string, error) {
+	f, err := os.Open(envFile) //nolint:gosec // The env files are chosen by the deployer configuration.
+	if err != nil {
+		return nil, fmt.Errorf("failed to open env file (%w)", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	var env []string
+	var errs []error
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimLeftFunc(scanner.Text(), unicode.IsSpace)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, _, _ := strings.Cut(line, "=")
+		switch {
+		case name == "":
+			errs = append(errs, fmt.Errorf("env file %s line %d: variable has no name", envFile, lineNumber))
+		case strings.ContainsFunc(name, unicode.IsSpace):
+			errs = append(errs, fmt.Errorf("env file %s line %d: variable name %q contains whitespace", envFile, lineNumber, name))
+		default:
+			env = append(env, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to read env file %s (%w)", envFile, err))
+	}
+	return env, errors.Join(errs...)
+}
+
+// validateEnvPassthrough checks that the passthrough patterns are valid glob patterns.
+func validateEnvPassthrough(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid environment variable passthrough pattern %q (%w)", pattern, err)
+		}
+	}
+	return nil
+}
+
+// passthroughEnv returns the entries of the environment whose variable name matches one of the patterns.
+func passthroughEnv(patterns []string, environ []string) []string {
+	var env []string
+	for _, entry := range environ {
+		name, _, _ := strings.Cut(entry, "=")
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, name); matched {
+				env = append(env, entry)
+				break
+			}
+		}
+	}
+	return env
+}
@@ -0,0 +1,188 @@
+package podman
+
+import (
+	"fmt"
+	"strings"
+)
+
+// deniedExtraArgs are the podman run flags the deployer relies on, mapped to the reason they cannot be passed as
+// extra arguments.
+var deniedExtraArgs = map[string]string{
+	"-a":            "the plugin communicates over the attached standard streams",
+	"--attach":      "the plugin communicates over the attached standard streams",
+	"-i":            "the plugin communicates over the attached standard streams",
+	"--interactive": "the plugin communicates over the attached standard streams",
+	"-t":            "a TTY would corrupt the plugin communication",
+	"--tty":         "a TTY would corrupt the plugin communication",
+	"-d":            "the plugin communicates over the attached standard streams",
+	"--detach":      "the plugin communicates over the attached standard streams",
+	"--name":        "the deployer names the containers; use podman -> containerNamePrefix instead",
+	"--replace":     "the deployer names the containers; use podman -> containerNamePrefix instead",
+	"--rm":          "the deployer removes the containers when the plugin is closed",
+	"--restart":     "the deployer manages the lifecycle of the containers",
+	"--stop-signal": "use deployment -> stopSignal instead",
+	"--rootfs":      "podman would treat the plugin image as a root filesystem path on the host",
+}
+
+// booleanShortFlags are the podman run short flags without a value, which may be followed by other short flags in
+// the same argument, e.g. -it.
+const booleanShortFlags = "ditPq"
+
+// valueShortFlags are the podman run short flags that take the next argument as their value if it is not part of the
+// same argument, e.g. -e DEBUG=1.
+const valueShortFlags = "acehlmpuvw"
+
+// booleanLongFlags are the podman run long flags without a value.
+var booleanLongFlags = map[string]bool{
+	"--detach":                true,
+	"--disable-content-trust": true,
+	"--env-host":              true,
+	"--http-proxy":            true,
+	"--init":                  true,
+	"--interactive":           true,
+	"--no-healthcheck":        true,
+	"--no-hostname":           true,
+	"--no-hosts":              true,
+	"--oom-kill-disable":      true,
+	"--passwd":                true,
+	"--privileged":            true,
+	"--publish-all":           true,
+	"--quiet":                 true,
+	"--read-only":             true,
+	"--read-only-tmpfs":       true,
+	"--replace":               true,
+	"--rm":                    true,
+	"--rmi":                   true,
+	"--sig-proxy":             true,
+	"--tls-verify":            true,
+	"--tty":                   true,
+	"--unsetenv-all":          true,
+}
+
+// valueLongFlags are the podman run long flags that take the next argument as their value if it is not passed as
+// --flag=value. Long flags in neither list must be passed as --flag=value, so a flag podman adds later cannot hide the
+// argument after it from the deny-list.
+var valueLongFlags = map[string]bool{
+	"--add-host":           true,
+	"--annotation":         true,
+	"--cap-add":            true,
+	"--cap-drop":           true,
+	"--cgroup-parent":      true,
+	"--cgroupns":           true,
+	"--cpu-period":         true,
+	"--cpu-quota":          true,
+	"--cpu-shares":         true,
+	"--cpus":               true,
+	"--cpuset-cpus":        true,
+	"--cpuset-mems":        true,
+	"--device":             true,
+	"--dns":                true,
+	"--dns-option":         true,
+	"--dns-search":         true,
+	"--entrypoint":         true,
+	"--env":                true,
+	"--env-file":           true,
+	"--expose":             true,
+	"--group-add":          true,
+	"--health-cmd":         true,
+	"--hostname":           true,
+	"--ip":                 true,
+	"--ipc":                true,
+	"--label":              true,
+	"--label-file":         true,
+	"--log-driver":         true,
+	"--log-opt":            true,
+	"--mac-address":        true,
+	"--memory":             true,
+	"--memory-reservation": true,
+	"--memory-swap":        true,
+	"--mount":              true,
+	"--network":            true,
+	"--network-alias":      true,
+	"--pid":                true,
+	"--pids-limit":         true,
+	"--platform":           true,
+	"--publish":            true,
+	"--pull":               true,
+	"--secret":             true,
+	"--security-opt":       true,
+	"--shm-size":           true,
+	"--sysctl":             true,
+	"--tmpfs":              true,
+	"--tz":                 true,
+	"--ulimit":             true,
+	"--user":               true,
+	"--userns":             true,
+	"--uts":                true,
+	"--volume":             true,
+	"--workdir":            true,
+}
+
+// validateExtraArgs rejects extra arguments that would interfere with the flags the deployer sets. Every argument
+// must be a flag or the value of the flag before it, as podman would take any other argument as the image. The value
+// of a flag is never checked, so ["--label", "-d"] sets the label -d.
+func validateExtraArgs(extraArgs []string) error {
+	for i := 0; i < len(extraArgs); i++ {
+		arg := extraArgs[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") || arg == "-" {
+			return fmt.Errorf(
+				"extra argument %s is not allowed because it is not a flag, and podman would take it as the image",
+				arg,
+			)
+		}
+		flags, takesNextArg, err := extraArgFlags(arg)
+		for _, flag := range flags {
+			if reason, denied := deniedExtraArgs[flag]; denied {
+				return fmt.Errorf("extra argument %s is not allowed because %s", arg, reason)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if takesNextArg {
+			if i == len(extraArgs)-1 {
+				return fmt.Errorf("extra argument %s is missing its value", arg)
+			}
+			i++
+		}
+	}
+	return nil
+}
+
+// extraArgFlags returns the flags an argument sets, splitting off the value of --flag=value and splitting combined
+// short flags such as -it. takesNextArg is true if the last flag takes a value that is not part of the argument, so
+// the next argument is its value. Flags not known to take a value or not must carry their value in the argument.
+func extraArgFlags(arg string) (flags []string, takesNextArg bool, err error) {
+	if strings.HasPrefix(arg, "--") {
+		flag, _, hasValue := strings.Cut(arg, "=")
+		switch {
+		case hasValue || booleanLongFlags[flag]:
+			return []string{flag}, false, nil
+		case valueLongFlags[flag]:
+			return []string{flag}, true, nil
+		default:
+			return []string{flag}, false, fmt.Errorf(
+				"extra argument %s must be passed with its value as %s=<value>",
+				arg,
+				flag,
+			)
+		}
+	}
+	for i, c := range arg[1:] {
+		flag := "-" + string(c)
+		flags = append(flags, flag)
+		if strings.ContainsRune(booleanShortFlags, c) {
+			continue
+		}
+		// The rest of the argument is the value of a flag that takes one.
+		switch {
+		case i < len(arg)-2:
+			return flags, false, nil
+		case strings.ContainsRune(valueShortFlags, c):
+			return flags, true, nil
+		default:
+			return flags, false, fmt.Errorf("extra argument %s must be passed with its value as %s<value>", arg, flag)
+		}
+	}
+	return flags, false, nil
+}
@@ -1,6 +1,7 @@
 package podman
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
@@ -36,11 +37,13 @@ func (f factory) ConfigurationSchema() *schema.TypedScopeSchema[*Config] {
 }
 
 func (f factory) Create(config *Config, logger log.Logger) (deployer.Connector, error) {
-	podmanPath, err := binaryCheck(config.Podman.Path)
+	if err := config.validateOptions(); err != nil {
+		return &Connector{}, fmt.Errorf("invalid podman deployer configuration (%w)", err)
+	}
+	newWrapper, err := newWrapperFactory(config, logger)
 	if err != nil {
-		return &Connector{}, fmt.Errorf("podman binary check failed with error: %w", err)
+		return &Connector{}, err
 	}
-	podman := cliwrapper.NewCliWrapper(podmanPath, logger, config.Podman.ConnectionName)
 
 	var rngSeed int64
 	if config.Podman.RngSeed == 0 {
@@ -57,14 +60,67 @@ func (f factory) Create(config *Config, logger log.Logger) (deployer.Connector,
 		containerNamePrefix = config.Podman.ContainerNamePrefix
 	}
 
-	return &Connector{
+	connector := &Connector{
 		config:              config,
 		logger:              logger,
-		podmanCliWrapper:    podman,
+		podmanCliWrapper:    newWrapper(config.Podman.connection()),
+		newWrapper:          newWrapper,
+		connectionWrappers:  map[string]cliwrapper.CliWrapper{},
 		containerNamePrefix: containerNamePrefix,
 		rng:                 rng,
 		rngSeed:             rngSeed,
 		lock:                &sync.Mutex{},
+	}
+	// The validation guarantees a valid minimum version.
+	minimumVersion, _ := config.Podman.minimumVersion()
+	// Detect the capabilities of the connection the deployments use.
+	capabilities, err := detectCapabilities(context.Background(), connector.wrapper(), minimumVersion)
+	if err != nil {
+		return &Connector{}, err
+	}
+	logger.Debugf(
+		"podman %s (client %s), rootless: %t, cgroup %s, OCI runtime %s, network backend %s",
+		capabilities.ServerVersion,
+		capabilities.ClientVersion,
+		capabilities.Rootless,
+		capabilities.CgroupVersion,
+		capabilities.OCIRuntime,
+		capabilities.NetworkBackend,
+	)
+	connector.capabilities = capabilities
+	return connector, nil
+}
+
+// newWrapperFactory checks the options of the configured backend and returns a function creating the podman wrapper
+// of a connection. The api backend has no connections, so all of them share its wrapper.
+func newWrapperFactory(config *Config, logger log.Logger) (func(connection cliwrapper.Connection) cliwrapper.CliWrapper, error) {
+	sensitivePatterns, err := compileSensitivePatterns(config.Podman.SensitivePatterns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid podman deployer configuration (%w)", err)
+	}
+	timeouts := config.Timeouts.withDefaults()
+	wrapperTimeouts := cliwrapper.Timeouts{
+		ImagePull:      timeouts.ImagePull,
+		ContainerStart: timeouts.ContainerStart,
+		ATPHandshake:   timeouts.ATPHandshake,
+		Kill:           timeouts.Kill,
+		Remove:         timeouts.Remove,
+		SecretCreate:   timeouts.SecretCreate,
+		Probe:          timeouts.Probe,
+	}
+	if config.Podman.Backend == BackendAPI {
+		wrapper, err := cliwrapper.NewAPIWrapper(config.Podman.APIURL, logger, wrapperTimeouts, sensitivePatterns)
+		if err != nil {
+			return nil, err
+		}
+		return func(_ cliwrapper.Connection) cliwrapper.CliWrapper { return wrapper }, nil
+	}
+	podmanPath, err := binaryCheck(config.Podman.Path)
+	if err != nil {
+		return nil, fmt.Errorf("podman binary check failed with error: %w", err)
+	}
+	return func(connection cliwrapper.Connection) cliwrapper.CliWrapper {
+		return cliwrapper.NewCliWrapper(podmanPath, logger, connection, wrapperTimeouts, sensitivePatterns)
 	}, nil
 }
 
@@ -0,0 +1,59 @@
+package podman
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ImageVerification restricts the plugin images which may be run.
+type ImageVerification struct {
+	// AllowedDigests are the digests of the images which may be run, e.g. sha256:<hex>. An image is allowed if one
+	// of its repository digests is in the list. No restriction if empty.
+	AllowedDigests []string `json:"allowedDigests"`
+	// SignaturePolicy is the path of a containers-policy.json file on the engine host which the signatures of pulled
+	// images are verified against. Requires the Always image pull policy, since only pulls verify signatures, and a
+	// local podman CLI, since remote podman services cannot read the file.
+	SignaturePolicy string `json:"signaturePolicy"`
+}
+
+// validate checks that the image pull policy and the podman connection allow the configured verification.
+func (v ImageVerification) validate(pullPolicy ImagePullPolicy, localPodman bool) error {
+	if v.SignaturePolicy == "" {
+		return nil
+	}
+	if pullPolicy != ImagePullPolicyAlways {
+		return fmt.Errorf(
+			"verifying image signatures requires the %s image pull policy, since only pulls verify them",
+			ImagePullPolicyAlways,
+		)
+	}
+	if !localPodman {
+		return fmt.Errorf(
+			"verifying image signatures requires a local podman CLI; the %s backend and remote podman services "+
+				"cannot read the signature policy on the engine host",
+			BackendAPI,
+		)
+	}
+	return nil
+}
+
+// allowedReference returns the first repository digest reference of the image whose digest is allowed, which pins
+// the image for running it. Returns an error naming the digests of the image if none is allowed.
+func (v ImageVerification) allowedReference(image string, repoDigests []string) (string, error) {
+	if len(repoDigests) == 0 {
+		return "", fmt.Errorf(
+			"image %s has no repository digest to verify; only images pulled from a registry can be verified",
+			image,
+		)
+	}
+	digests := make([]string, len(repoDigests))
+	for i, reference := range repoDigests {
+		_, digests[i], _ = strings.Cut(reference, "@")
+		if slices.Contains(v.AllowedDigests, digests[i]) {
+			return reference, nil
+		}
+	}
+	return "", fmt.Errorf("image %s is not allowed; none of its digests %s is in the allowed digests",
+		image, strings.Join(digests, ", "))
+}
@@ -1,27 +1,79 @@
 package argsbuilder
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"go.flow.arcalot.io/podmandeployer/internal/util"
 )
 
 type argsBuilder struct {
 	commandArgs *[]string
+	host        Host
+	// Validation errors of the rejected entries, in the order they were set.
+	errs []error
+}
+
+func (a *argsBuilder) Err() error {
+	return errors.Join(a.errs...)
 }
 
 func (a *argsBuilder) SetEnv(env []string) ArgsBuilder {
 	for _, v := range env {
-		if tokens := strings.Split(v, "="); len(tokens) == 2 {
-			*a.commandArgs = append(*a.commandArgs, "-e", v)
+		// Entries without a value inherit the variable from the environment of podman.
+		if name, _, _ := strings.Cut(v, "="); name == "" {
+			a.errs = append(a.errs, fmt.Errorf("environment variable %q has no name", v))
+			continue
 		}
+		*a.commandArgs = append(*a.commandArgs, "-e", v)
 	}
 	return a
 }
 
 func (a *argsBuilder) SetVolumes(binds []string) ArgsBuilder {
 	for _, v := range binds {
-		if tokens := strings.Split(v, ":"); len(tokens) == 2 || len(tokens) == 3 {
-			*a.commandArgs = append(*a.commandArgs, "-v", v)
+		if err := validateBind(v); err != nil {
+			a.errs = append(a.errs, err)
+			continue
 		}
+		*a.commandArgs = append(*a.commandArgs, "-v", v)
+	}
+	return a
+}
+
+// windowsDrivePattern matches a Windows drive letter at the start of a bind source, whose colon does not separate the
+// source from the target.
+var windowsDrivePattern = regexp.MustCompile(`^[a-zA-Z]:[\\/]`)
+
+// validateBind checks that a bind has the source:target[:options] format with an absolute target.
+func validateBind(bind string) error {
+	rest := bind
+	if loc := windowsDrivePattern.FindStringIndex(rest); loc != nil {
+		rest = rest[loc[1]:]
+	}
+	tokens := strings.Split(rest, ":")
+	switch {
+	case len(tokens) < 2 || len(tokens) > 3:
+		return fmt.Errorf("bind %q must have the source:target[:options] format; use mounts for paths containing colons", bind)
+	case tokens[0] == "" && rest == bind:
+		return fmt.Errorf("bind %q has no source", bind)
+	case !strings.HasPrefix(tokens[1], "/"):
+		return fmt.Errorf("bind %q must have an absolute target path", bind)
+	case len(tokens) == 3 && tokens[2] == "":
+		return fmt.Errorf("bind %q has an empty option list", bind)
+	}
+	return nil
+}
+
+func (a *argsBuilder) SetMounts(mounts []string) ArgsBuilder {
+	for _, mount := range mounts {
+		*a.commandArgs = append(*a.commandArgs, "--mount", mount)
 	}
 	return a
 }
@@ -40,10 +92,22 @@ func (a *argsBuilder) SetContainerName(name string) ArgsBuilder {
 	return a
 }
 
+// pastaVersion is the first podman version with the pasta network mode.
+var pastaVersion = util.Version{Major: 4, Minor: 4}
+
 func (a *argsBuilder) SetNetworkMode(networkMode string) ArgsBuilder {
-	if networkMode != "" {
-		*a.commandArgs = append(*a.commandArgs, "--network", networkMode)
+	if networkMode == "" {
+		return a
+	}
+	if mode, _, _ := strings.Cut(networkMode, ":"); mode == "pasta" && a.host.olderThan(pastaVersion) {
+		a.errs = append(a.errs, fmt.Errorf(
+			"network mode pasta requires podman %s or later; the podman service has version %s",
+			pastaVersion,
+			a.host.Version,
+		))
+		return a
 	}
+	*a.commandArgs = append(*a.commandArgs, "--network", networkMode)
 	return a
 }
 
@@ -53,3 +117,241 @@ func (a *argsBuilder) SetPrivileged(privileged bool) ArgsBuilder {
 	}
 	return a
 }
+
+func (a *argsBuilder) SetStopSignal(signal string) ArgsBuilder {
+	if signal != "" {
+		*a.commandArgs = append(*a.commandArgs, "--stop-signal", signal)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetHostname(hostname string) ArgsBuilder {
+	if hostname != "" {
+		*a.commandArgs = append(*a.commandArgs, "--hostname", hostname)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetDomainname(domainname string) ArgsBuilder {
+	if domainname != "" {
+		*a.commandArgs = append(*a.commandArgs, "--domainname", domainname)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetUser(user string) ArgsBuilder {
+	if user != "" {
+		*a.commandArgs = append(*a.commandArgs, "--user", user)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetNetworkDisabled(disabled bool) ArgsBuilder {
+	if disabled {
+		*a.commandArgs = append(*a.commandArgs, "--network", "none")
+	}
+	return a
+}
+
+func (a *argsBuilder) SetMacAddress(macAddress string) ArgsBuilder {
+	if macAddress != "" {
+		*a.commandArgs = append(*a.commandArgs, "--mac-address", macAddress)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetCapAdd(capabilities []string) ArgsBuilder {
+	for _, capability := range capabilities {
+		*a.commandArgs = append(*a.commandArgs, "--cap-add", capability)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetCapDrop(capabilities []string) ArgsBuilder {
+	for _, capability := range capabilities {
+		*a.commandArgs = append(*a.commandArgs, "--cap-drop", capability)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetDNS(servers []string) ArgsBuilder {
+	for _, server := range servers {
+		*a.commandArgs = append(*a.commandArgs, "--dns", server)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetDNSOptions(options []string) ArgsBuilder {
+	for _, option := range options {
+		*a.commandArgs = append(*a.commandArgs, "--dns-option", option)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetDNSSearch(domains []string) ArgsBuilder {
+	for _, domain := range domains {
+		*a.commandArgs = append(*a.commandArgs, "--dns-search", domain)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetExtraHosts(hosts []string) ArgsBuilder {
+	for _, host := range hosts {
+		*a.commandArgs = append(*a.commandArgs, "--add-host", host)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetPortBindings(portBindings nat.PortMap) ArgsBuilder {
+	ports := make([]string, 0, len(portBindings))
+	for port := range portBindings {
+		ports = append(ports, string(port))
+	}
+	sort.Strings(ports)
+	for _, port := range ports {
+		bindings := portBindings[nat.Port(port)]
+		if len(bindings) == 0 {
+			// Publish the container port on a random host port.
+			*a.commandArgs = append(*a.commandArgs, "-p", port)
+			continue
+		}
+		for _, binding := range bindings {
+			*a.commandArgs = append(*a.commandArgs, "-p", publishSpec(port, binding))
+		}
+	}
+	return a
+}
+
+// publishSpec formats a port binding in the ip:hostPort:containerPort format of podman run --publish.
+func publishSpec(containerPort string, binding nat.PortBinding) string {
+	switch {
+	case binding.HostIP != "":
+		hostIP := binding.HostIP
+		if strings.Contains(hostIP, ":") {
+			hostIP = "[" + hostIP + "]"
+		}
+		return hostIP + ":" + binding.HostPort + ":" + containerPort
+	case binding.HostPort != "":
+		return binding.HostPort + ":" + containerPort
+	default:
+		return containerPort
+	}
+}
+
+// supportsResourceLimit checks whether the host enforces the resource limit. Rootless podman on cgroup v1 hosts ignores
+// resource limits with a mere warning, so the limit is rejected instead.
+func (a *argsBuilder) supportsResourceLimit(limit string) bool {
+	if a.host.Rootless && a.host.CgroupVersion == "v1" {
+		a.errs = append(a.errs, fmt.Errorf("the %s limit is not supported by rootless podman on cgroup v1 hosts", limit))
+		return false
+	}
+	return true
+}
+
+func (a *argsBuilder) SetMemory(memory int64) ArgsBuilder {
+	if memory > 0 && a.supportsResourceLimit("memory") {
+		*a.commandArgs = append(*a.commandArgs, "--memory", strconv.FormatInt(memory, 10))
+	}
+	return a
+}
+
+func (a *argsBuilder) SetMemorySwap(memorySwap int64) ArgsBuilder {
+	// -1 allows unlimited swap, 0 leaves the default of twice the memory limit.
+	if memorySwap != 0 && a.supportsResourceLimit("memory swap") {
+		*a.commandArgs = append(*a.commandArgs, "--memory-swap", strconv.FormatInt(memorySwap, 10))
+	}
+	return a
+}
+
+func (a *argsBuilder) SetNanoCPUs(nanoCPUs int64) ArgsBuilder {
+	if nanoCPUs > 0 && a.supportsResourceLimit("CPU") {
+		*a.commandArgs = append(*a.commandArgs, "--cpus", strconv.FormatFloat(float64(nanoCPUs)/1e9, 'f', -1, 64))
+	}
+	return a
+}
+
+func (a *argsBuilder) SetCPUShares(cpuShares int64) ArgsBuilder {
+	if cpuShares > 0 && a.supportsResourceLimit("CPU shares") {
+		*a.commandArgs = append(*a.commandArgs, "--cpu-shares", strconv.FormatInt(cpuShares, 10))
+	}
+	return a
+}
+
+func (a *argsBuilder) SetCpusetCpus(cpusetCpus string) ArgsBuilder {
+	if cpusetCpus != "" && a.supportsResourceLimit("CPU set") {
+		*a.commandArgs = append(*a.commandArgs, "--cpuset-cpus", cpusetCpus)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetPidsLimit(pidsLimit *int64) ArgsBuilder {
+	if pidsLimit != nil && a.supportsResourceLimit("PIDs") {
+		*a.commandArgs = append(*a.commandArgs, "--pids-limit", strconv.FormatInt(*pidsLimit, 10))
+	}
+	return a
+}
+
+func (a *argsBuilder) SetUlimits(ulimits []*container.Ulimit) ArgsBuilder {
+	for _, ulimit := range ulimits {
+		if ulimit != nil {
+			*a.commandArgs = append(*a.commandArgs, "--ulimit", ulimit.String())
+		}
+	}
+	return a
+}
+
+func (a *argsBuilder) SetUserNS(userNS string) ArgsBuilder {
+	if userNS != "" {
+		*a.commandArgs = append(*a.commandArgs, "--userns", userNS)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetUIDMap(uidMap []string) ArgsBuilder {
+	for _, mapping := range uidMap {
+		*a.commandArgs = append(*a.commandArgs, "--uidmap", mapping)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetGIDMap(gidMap []string) ArgsBuilder {
+	for _, mapping := range gidMap {
+		*a.commandArgs = append(*a.commandArgs, "--gidmap", mapping)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetPod(pod string) ArgsBuilder {
+	if pod != "" {
+		*a.commandArgs = append(*a.commandArgs, "--pod", pod)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetSecrets(secrets []string) ArgsBuilder {
+	for _, secret := range secrets {
+		*a.commandArgs = append(*a.commandArgs, "--secret", secret)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetSecurityOpts(securityOpts []string) ArgsBuilder {
+	for _, securityOpt := range securityOpts {
+		*a.commandArgs = append(*a.commandArgs, "--security-opt", securityOpt)
+	}
+	return a
+}
+
+func (a *argsBuilder) SetReadOnlyTmpfs(readOnlyTmpfs *bool) ArgsBuilder {
+	if readOnlyTmpfs != nil {
+		*a.commandArgs = append(*a.commandArgs, "--read-only-tmpfs="+strconv.FormatBool(*readOnlyTmpfs))
+	}
+	return a
+}
+
+func (a *argsBuilder) SetSDNotify(sdNotify string) ArgsBuilder {
+	if sdNotify != "" {
+		*a.commandArgs = append(*a.commandArgs, "--sdnotify", sdNotify)
+	}
+	return a
+}
@@ -1,16 +1,74 @@
 package argsbuilder
 
+import (
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"go.flow.arcalot.io/podmandeployer/internal/util"
+)
+
+// Host describes the podman service the arguments are built for. Setters reject the entries the host does not
+// support. The zero value describes an unknown host, on which no entry is rejected.
+type Host struct {
+	// Version is the version of the podman service; the zero value is an unknown version.
+	Version  util.Version
+	Rootless bool
+	// CgroupVersion is the cgroup version of the host, "v1" or "v2".
+	CgroupVersion string
+}
+
+// olderThan reports whether the podman service is known to be older than the version.
+func (h Host) olderThan(version util.Version) bool {
+	return h.Version != (util.Version{}) && h.Version.Less(version)
+}
+
 type ArgsBuilder interface {
+	// Err returns the validation errors of all entries rejected by the setters so far, or nil.
+	Err() error
 	SetEnv(env []string) ArgsBuilder
 	SetVolumes(binds []string) ArgsBuilder
+	SetMounts(mounts []string) ArgsBuilder
 	SetCgroupNs(cgroupNs string) ArgsBuilder
 	SetContainerName(name string) ArgsBuilder
 	SetNetworkMode(networkMode string) ArgsBuilder
 	SetPrivileged(privileged bool) ArgsBuilder
+	SetStopSignal(signal string) ArgsBuilder
+	SetHostname(hostname string) ArgsBuilder
+	SetDomainname(domainname string) ArgsBuilder
+	SetUser(user string) ArgsBuilder
+	SetNetworkDisabled(disabled bool) ArgsBuilder
+	SetMacAddress(macAddress string) ArgsBuilder
+	SetCapAdd(capabilities []string) ArgsBuilder
+	SetCapDrop(capabilities []string) ArgsBuilder
+	SetDNS(servers []string) ArgsBuilder
+	SetDNSOptions(options []string) ArgsBuilder
+	SetDNSSearch(domains []string) ArgsBuilder
+	SetExtraHosts(hosts []string) ArgsBuilder
+	SetPortBindings(portBindings nat.PortMap) ArgsBuilder
+	SetMemory(memory int64) ArgsBuilder
+	SetMemorySwap(memorySwap int64) ArgsBuilder
+	SetNanoCPUs(nanoCPUs int64) ArgsBuilder
+	SetCPUShares(cpuShares int64) ArgsBuilder
+	SetCpusetCpus(cpusetCpus string) ArgsBuilder
+	SetPidsLimit(pidsLimit *int64) ArgsBuilder
+	SetUlimits(ulimits []*container.Ulimit) ArgsBuilder
+	SetUserNS(userNS string) ArgsBuilder
+	SetUIDMap(uidMap []string) ArgsBuilder
+	SetGIDMap(gidMap []string) ArgsBuilder
+	SetPod(pod string) ArgsBuilder
+	SetSecrets(secrets []string) ArgsBuilder
+	SetSecurityOpts(securityOpts []string) ArgsBuilder
+	SetReadOnlyTmpfs(readOnlyTmpfs *bool) ArgsBuilder
+	SetSDNotify(sdNotify string) ArgsBuilder
 }
 
 func NewBuilder(commandArgs *[]string) ArgsBuilder {
+	return NewHostBuilder(commandArgs, Host{})
+}
+
+// NewHostBuilder creates a builder for the arguments of a container on the podman host.
+func NewHostBuilder(commandArgs *[]string, host Host) ArgsBuilder {
 	return &argsBuilder{
 		commandArgs: commandArgs,
+		host:        host,
 	}
 }
@@ -0,0 +1,438 @@
+package argsbuilder_test
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"go.arcalot.io/assert"
+	"go.flow.arcalot.io/podmandeployer/internal/argsbuilder"
+	"go.flow.arcalot.io/podmandeployer/internal/util"
+)
+
+func TestArgsBuilder_ContainerIdentity(t *testing.T) {
+	scenarios := map[string]struct {
+		build    func(builder argsbuilder.ArgsBuilder)
+		expected []string
+	}{
+		"Hostname": {
+			func(b argsbuilder.ArgsBuilder) { b.SetHostname("plugin-host") },
+			[]string{"--hostname", "plugin-host"},
+		},
+		"Domainname": {
+			func(b argsbuilder.ArgsBuilder) { b.SetDomainname("example.com") },
+			[]string{"--domainname", "example.com"},
+		},
+		"User": {
+			func(b argsbuilder.ArgsBuilder) { b.SetUser("1000:1000") },
+			[]string{"--user", "1000:1000"},
+		},
+		"NetworkDisabled": {
+			func(b argsbuilder.ArgsBuilder) { b.SetNetworkDisabled(true) },
+			[]string{"--network", "none"},
+		},
+		"MacAddress": {
+			func(b argsbuilder.ArgsBuilder) { b.SetMacAddress("44:33:22:11:00:99") },
+			[]string{"--mac-address", "44:33:22:11:00:99"},
+		},
+		"Unset": {
+			func(b argsbuilder.ArgsBuilder) {
+				b.SetHostname("").SetDomainname("").SetUser("").SetNetworkDisabled(false).SetMacAddress("")
+			},
+			[]string{},
+		},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			commandArgs := []string{}
+			scenario.build(argsbuilder.NewBuilder(&commandArgs))
+			assert.Equals(t, commandArgs, scenario.expected)
+		})
+	}
+}
+
+func TestArgsBuilder_CapabilitiesAndDNS(t *testing.T) {
+	scenarios := map[string]struct {
+		build    func(builder argsbuilder.ArgsBuilder)
+		expected []string
+	}{
+		"CapAdd": {
+			func(b argsbuilder.ArgsBuilder) { b.SetCapAdd([]string{"NET_RAW", "CAP_SYS_TIME"}) },
+			[]string{"--cap-add", "NET_RAW", "--cap-add", "CAP_SYS_TIME"},
+		},
+		"CapDrop": {
+			func(b argsbuilder.ArgsBuilder) { b.SetCapDrop([]string{"ALL"}) },
+			[]string{"--cap-drop", "ALL"},
+		},
+		"DNS": {
+			func(b argsbuilder.ArgsBuilder) { b.SetDNS([]string{"10.0.0.53", "fd00::53"}) },
+			[]string{"--dns", "10.0.0.53", "--dns", "fd00::53"},
+		},
+		"DNSOptions": {
+			func(b argsbuilder.ArgsBuilder) { b.SetDNSOptions([]string{"ndots:2", "edns0"}) },
+			[]string{"--dns-option", "ndots:2", "--dns-option", "edns0"},
+		},
+		"DNSSearch": {
+			func(b argsbuilder.ArgsBuilder) { b.SetDNSSearch([]string{"lab.example.com"}) },
+			[]string{"--dns-search", "lab.example.com"},
+		},
+		"ExtraHosts": {
+			func(b argsbuilder.ArgsBuilder) {
+				b.SetExtraHosts([]string{"registry.lab:10.0.0.5", "gateway:host-gateway"})
+			},
+			[]string{"--add-host", "registry.lab:10.0.0.5", "--add-host", "gateway:host-gateway"},
+		},
+		"Combined": {
+			func(b argsbuilder.ArgsBuilder) {
+				b.SetCapDrop([]string{"ALL"}).SetCapAdd([]string{"NET_RAW"}).SetDNS([]string{"10.0.0.53"})
+			},
+			[]string{"--cap-drop", "ALL", "--cap-add", "NET_RAW", "--dns", "10.0.0.53"},
+		},
+		"Unset": {
+			func(b argsbuilder.ArgsBuilder) {
+				b.SetCapAdd(nil).SetCapDrop(nil).SetDNS(nil).SetDNSOptions(nil).SetDNSSearch(nil).SetExtraHosts(nil)
+			},
+			[]string{},
+		},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			commandArgs := []string{}
+			scenario.build(argsbuilder.NewBuilder(&commandArgs))
+			assert.Equals(t, commandArgs, scenario.expected)
+		})
+	}
+}
+
+func TestArgsBuilder_PortBindings(t *testing.T) {
+	scenarios := map[string]struct {
+		portBindings nat.PortMap
+		expected     []string
+	}{
+		"HostPort": {
+			nat.PortMap{"8080/tcp": {{HostPort: "18080"}}},
+			[]string{"-p", "18080:8080/tcp"},
+		},
+		"HostIP": {
+			nat.PortMap{"8080/tcp": {{HostIP: "127.0.0.1", HostPort: "18080"}}},
+			[]string{"-p", "127.0.0.1:18080:8080/tcp"},
+		},
+		"HostIPv6": {
+			nat.PortMap{"8080/tcp": {{HostIP: "::1", HostPort: "18080"}}},
+			[]string{"-p", "[::1]:18080:8080/tcp"},
+		},
+		"HostIPRandomPort": {
+			nat.PortMap{"8080/tcp": {{HostIP: "127.0.0.1"}}},
+			[]string{"-p", "127.0.0.1::8080/tcp"},
+		},
+		"RandomPort": {
+			nat.PortMap{"8080": {}},
+			[]string{"-p", "8080"},
+		},
+		"EmptyBinding": {
+			nat.PortMap{"8080": {{}}},
+			[]string{"-p", "8080"},
+		},
+		"Range": {
+			nat.PortMap{"9000-9010/udp": {{HostPort: "19000-19010"}}},
+			[]string{"-p", "19000-19010:9000-9010/udp"},
+		},
+		"MultipleSorted": {
+			nat.PortMap{
+				"9090/tcp": {{HostPort: "19090"}},
+				"8080/tcp": {{HostIP: "127.0.0.1", HostPort: "18080"}, {HostIP: "::1", HostPort: "18080"}},
+			},
+			[]string{"-p", "127.0.0.1:18080:8080/tcp", "-p", "[::1]:18080:8080/tcp", "-p", "19090:9090/tcp"},
+		},
+		"Unset": {
+			nil,
+			[]string{},
+		},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			commandArgs := []string{}
+			argsbuilder.NewBuilder(&commandArgs).SetPortBindings(scenario.portBindings)
+			assert.Equals(t, commandArgs, scenario.expected)
+		})
+	}
+}
+
+func TestArgsBuilder_Resources(t *testing.T) {
+	pidsLimit := int64(100)
+	unlimitedPids := int64(-1)
+	scenarios := map[string]struct {
+		build    func(builder argsbuilder.ArgsBuilder)
+		expected []string
+	}{
+		"Memory": {
+			func(b argsbuilder.ArgsBuilder) { b.SetMemory(64 * 1024 * 1024) },
+			[]string{"--memory", "67108864"},
+		},
+		"MemorySwap": {
+			func(b argsbuilder.ArgsBuilder) { b.SetMemorySwap(128 * 1024 * 1024) },
+			[]string{"--memory-swap", "134217728"},
+		},
+		"MemorySwapUnlimited": {
+			func(b argsbuilder.ArgsBuilder) { b.SetMemorySwap(-1) },
+			[]string{"--memory-swap", "-1"},
+		},
+		"NanoCPUs": {
+			func(b argsbuilder.ArgsBuilder) { b.SetNanoCPUs(1500000000) },
+			[]string{"--cpus", "1.5"},
+		},
+		"NanoCPUsWhole": {
+			func(b argsbuilder.ArgsBuilder) { b.SetNanoCPUs(2000000000) },
+			[]string{"--cpus", "2"},
+		},
+		"CPUShares": {
+			func(b argsbuilder.ArgsBuilder) { b.SetCPUShares(512) },
+			[]string{"--cpu-shares", "512"},
+		},
+		"CpusetCpus": {
+			func(b argsbuilder.ArgsBuilder) { b.SetCpusetCpus("0-2,4") },
+			[]string{"--cpuset-cpus", "0-2,4"},
+		},
+		"PidsLimit": {
+			func(b argsbuilder.ArgsBuilder) { b.SetPidsLimit(&pidsLimit) },
+			[]string{"--pids-limit", "100"},
+		},
+		"PidsLimitUnlimited": {
+			func(b argsbuilder.ArgsBuilder) { b.SetPidsLimit(&unlimitedPids) },
+			[]string{"--pids-limit", "-1"},
+		},
+		"Ulimits": {
+			func(b argsbuilder.ArgsBuilder) {
+				b.SetUlimits([]*container.Ulimit{{Name: "nofile", Soft: 1024, Hard: 4096}, {Name: "core", Soft: 0, Hard: 0}})
+			},
+			[]string{"--ulimit", "nofile=1024:4096", "--ulimit", "core=0:0"},
+		},
+		"Unset": {
+			func(b argsbuilder.ArgsBuilder) {
+				b.SetMemory(0).SetMemorySwap(0).SetNanoCPUs(0).SetCPUShares(0).SetCpusetCpus("").SetPidsLimit(nil).SetUlimits(nil)
+			},
+			[]string{},
+		},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			commandArgs := []string{}
+			scenario.build(argsbuilder.NewBuilder(&commandArgs))
+			assert.Equals(t, commandArgs, scenario.expected)
+		})
+	}
+}
+
+func TestArgsBuilder_PodmanOptions(t *testing.T) {
+	readOnlyTmpfs := false
+	scenarios := map[string]struct {
+		build    func(builder argsbuilder.ArgsBuilder)
+		expected []string
+	}{
+		"UserNS": {
+			func(b argsbuilder.ArgsBuilder) { b.SetUserNS("keep-id:uid=1000,gid=1000") },
+			[]string{"--userns", "keep-id:uid=1000,gid=1000"},
+		},
+		"IDMaps": {
+			func(b argsbuilder.ArgsBuilder) {
+				b.SetUIDMap([]string{"0:1:1000", "1000:0:1"}).SetGIDMap([]string{"0:1:1000"})
+			},
+			[]string{"--uidmap", "0:1:1000", "--uidmap", "1000:0:1", "--gidmap", "0:1:1000"},
+		},
+		"Pod": {
+			func(b argsbuilder.ArgsBuilder) { b.SetPod("new:plugins") },
+			[]string{"--pod", "new:plugins"},
+		},
+		"Secrets": {
+			func(b argsbuilder.ArgsBuilder) { b.SetSecrets([]string{"token,type=env,target=TOKEN", "cert"}) },
+			[]string{"--secret", "token,type=env,target=TOKEN", "--secret", "cert"},
+		},
+		"SecurityOpts": {
+			func(b argsbuilder.ArgsBuilder) { b.SetSecurityOpts([]string{"label=disable", "no-new-privileges"}) },
+			[]string{"--security-opt", "label=disable", "--security-opt", "no-new-privileges"},
+		},
+		"ReadOnlyTmpfs": {
+			func(b argsbuilder.ArgsBuilder) { b.SetReadOnlyTmpfs(&readOnlyTmpfs) },
+			[]string{"--read-only-tmpfs=false"},
+		},
+		"SDNotify": {
+			func(b argsbuilder.ArgsBuilder) { b.SetSDNotify("conmon") },
+			[]string{"--sdnotify", "conmon"},
+		},
+		"Unset": {
+			func(b argsbuilder.ArgsBuilder) {
+				b.SetUserNS("").SetUIDMap(nil).SetGIDMap(nil).SetPod("").SetSecrets(nil).SetSecurityOpts(nil).
+					SetReadOnlyTmpfs(nil).SetSDNotify("")
+			},
+			[]string{},
+		},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			commandArgs := []string{}
+			scenario.build(argsbuilder.NewBuilder(&commandArgs))
+			assert.Equals(t, commandArgs, scenario.expected)
+		})
+	}
+}
+
+func TestArgsBuilder_Mounts(t *testing.T) {
+	commandArgs := []string{}
+	argsbuilder.NewBuilder(&commandArgs).SetMounts([]string{
+		"type=bind,source=/data,target=/data",
+		"type=tmpfs,target=/scratch",
+	})
+	assert.Equals(t, commandArgs, []string{
+		"--mount", "type=bind,source=/data,target=/data",
+		"--mount", "type=tmpfs,target=/scratch",
+	})
+}
+
+func TestArgsBuilder_EnvAndVolumes(t *testing.T) {
+	scenarios := map[string]struct {
+		build          func(builder argsbuilder.ArgsBuilder)
+		expected       []string
+		expectedErrMsg []string
+	}{
+		"EnvValueWithEquals": {
+			func(b argsbuilder.ArgsBuilder) { b.SetEnv([]string{"TOKEN=YWJj==", "DSN=host=db user=plugin"}) },
+			[]string{"-e", "TOKEN=YWJj==", "-e", "DSN=host=db user=plugin"},
+			nil,
+		},
+		"EnvEmptyValue": {
+			func(b argsbuilder.ArgsBuilder) { b.SetEnv([]string{"EMPTY="}) },
+			[]string{"-e", "EMPTY="},
+			nil,
+		},
+		"EnvInherited": {
+			func(b argsbuilder.ArgsBuilder) { b.SetEnv([]string{"HTTPS_PROXY"}) },
+			[]string{"-e", "HTTPS_PROXY"},
+			nil,
+		},
+		"EnvNoName": {
+			func(b argsbuilder.ArgsBuilder) { b.SetEnv([]string{"=value", "", "VALID=1"}) },
+			[]string{"-e", "VALID=1"},
+			[]string{`environment variable "=value" has no name`, `environment variable "" has no name`},
+		},
+		"Volumes": {
+			func(b argsbuilder.ArgsBuilder) {
+				b.SetVolumes([]string{"/data:/data", "/data:/data:ro,z,U", "cache:/cache", `C:\Users\plugin:/home:ro`})
+			},
+			[]string{"-v", "/data:/data", "-v", "/data:/data:ro,z,U", "-v", "cache:/cache", "-v", `C:\Users\plugin:/home:ro`},
+			nil,
+		},
+		"VolumesInvalid": {
+			func(b argsbuilder.ArgsBuilder) {
+				b.SetVolumes([]string{"/data", "/a:b:/data", "/a:/b:ro:z", ":/data", "/data:data", "/data:/data:"})
+			},
+			[]string{},
+			[]string{
+				`bind "/data" must have the source:target[:options] format`,
+				`bind "/a:b:/data" must have an absolute target path`,
+				`bind "/a:/b:ro:z" must have the source:target[:options] format`,
+				`bind ":/data" has no source`,
+				`bind "/data:data" must have an absolute target path`,
+				`bind "/data:/data:" has an empty option list`,
+			},
+		},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			commandArgs := []string{}
+			builder := argsbuilder.NewBuilder(&commandArgs)
+			scenario.build(builder)
+			assert.Equals(t, commandArgs, scenario.expected)
+			if scenario.expectedErrMsg == nil {
+				assert.NoError(t, builder.Err())
+				return
+			}
+			err := builder.Err()
+			assert.Error(t, err)
+			for _, msg := range scenario.expectedErrMsg {
+				assert.Contains(t, err.Error(), msg)
+			}
+		})
+	}
+}
+
+func TestArgsBuilder_Host(t *testing.T) {
+	pidsLimit := int64(100)
+	podman43 := util.Version{Major: 4, Minor: 3, Patch: 1}
+	podman49 := util.Version{Major: 4, Minor: 9, Patch: 3}
+	scenarios := map[string]struct {
+		host           argsbuilder.Host
+		build          func(builder argsbuilder.ArgsBuilder)
+		expected       []string
+		expectedErrMsg []string
+	}{
+		"ResourceLimitsRootlessCgroupV1": {
+			argsbuilder.Host{Version: podman49, Rootless: true, CgroupVersion: "v1"},
+			func(b argsbuilder.ArgsBuilder) {
+				b.SetMemory(1024).SetMemorySwap(-1).SetNanoCPUs(1e9).SetCPUShares(512).SetCpusetCpus("0").SetPidsLimit(&pidsLimit)
+			},
+			[]string{},
+			[]string{
+				"the memory limit is not supported by rootless podman on cgroup v1 hosts",
+				"the memory swap limit",
+				"the CPU limit",
+				"the CPU shares limit",
+				"the CPU set limit",
+				"the PIDs limit",
+			},
+		},
+		"ResourceLimitsRootfulCgroupV1": {
+			argsbuilder.Host{Version: podman49, CgroupVersion: "v1"},
+			func(b argsbuilder.ArgsBuilder) { b.SetMemory(1024) },
+			[]string{"--memory", "1024"},
+			nil,
+		},
+		"ResourceLimitsRootlessCgroupV2": {
+			argsbuilder.Host{Version: podman49, Rootless: true, CgroupVersion: "v2"},
+			func(b argsbuilder.ArgsBuilder) { b.SetMemory(1024) },
+			[]string{"--memory", "1024"},
+			nil,
+		},
+		"PastaOldPodman": {
+			argsbuilder.Host{Version: podman43, Rootless: true, CgroupVersion: "v2"},
+			func(b argsbuilder.ArgsBuilder) { b.SetNetworkMode("pasta:--ipv4-only") },
+			[]string{},
+			[]string{"network mode pasta requires podman 4.4.0 or later; the podman service has version 4.3.1"},
+		},
+		"Pasta": {
+			argsbuilder.Host{Version: podman49, Rootless: true, CgroupVersion: "v2"},
+			func(b argsbuilder.ArgsBuilder) { b.SetNetworkMode("pasta") },
+			[]string{"--network", "pasta"},
+			nil,
+		},
+		"UnknownHost": {
+			argsbuilder.Host{},
+			func(b argsbuilder.ArgsBuilder) { b.SetNetworkMode("pasta").SetMemory(1024) },
+			[]string{"--network", "pasta", "--memory", "1024"},
+			nil,
+		},
+	}
+	for name, s := range scenarios {
+		scenario := s
+		t.Run(name, func(t *testing.T) {
+			commandArgs := []string{}
+			builder := argsbuilder.NewHostBuilder(&commandArgs, scenario.host)
+			scenario.build(builder)
+			assert.Equals(t, commandArgs, scenario.expected)
+			if scenario.expectedErrMsg == nil {
+				assert.NoError(t, builder.Err())
+				return
+			}
+			err := builder.Err()
+			assert.Error(t, err)
+			for _, msg := range scenario.expectedErrMsg {
+				assert.Contains(t, err.Error(), msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,510 @@
+package cliwrapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	log "go.arcalot.io/log/v2"
+)
+
+// apiBasePath is the path prefix of the libpod API endpoints.
+const apiBasePath = "/v4.0.0/libpod"
+
+// maxAPIErrorSize bounds how much of an error response is read.
+const maxAPIErrorSize = 64 * 1024
+
+// APIError is an error response of the podman API.
+type APIError struct {
+	StatusCode int    `json:"response"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("podman API responded with status %d: %s", e.StatusCode, e.Message)
+}
+
+// isNotFound reports whether the error is a 404 response of the podman API.
+func isNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// ParseAPIURL returns the network and the address of the podman API URL, which
+// is either unix:///path/to/podman.sock or tcp://host:port.
+func ParseAPIURL(apiURL string) (string, string, error) {
+	parsed, err := url.Parse(apiURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid podman API URL %q (%w)", apiURL, err)
+	}
+	switch parsed.Scheme {
+	case "unix":
+		if parsed.Path == "" {
+			return "", "", fmt.Errorf("the podman API URL %q has no socket path", apiURL)
+		}
+		return "unix", parsed.Path, nil
+	case "tcp":
+		if parsed.Host == "" {
+			return "", "", fmt.Errorf("the podman API URL %q has no host", apiURL)
+		}
+		return "tcp", parsed.Host, nil
+	case "ssh":
+		return "", "", fmt.Errorf(
+			"the podman API URL %q uses SSH, which is not supported; forward the podman socket through an SSH tunnel"+
+				" (e.g. ssh -L) and use the unix:// or tcp:// URL of the tunnel",
+			apiURL,
+		)
+	}
+	return "", "", fmt.Errorf("the podman API URL %q must have the unix:// or tcp:// scheme", apiURL)
+}
+
+type apiWrapper struct {
+	client   *http.Client
+	dial     func(ctx context.Context) (net.Conn, error)
+	logger   log.Logger
+	timeouts Timeouts
+	redactor redactor
+}
+
+// NewAPIWrapper creates a wrapper which talks to the libpod REST API of the podman service listening on the URL,
+// instead of running the podman CLI. The deployment's podman run arguments are translated into a container
+// specification, so arguments without a translation are rejected. The matches of the sensitive patterns are masked in
+// the logged arguments and in the podman output embedded in errors.
+func NewAPIWrapper(
+	apiURL string,
+	logger log.Logger,
+	timeouts Timeouts,
+	sensitivePatterns []*regexp.Regexp,
+) (CliWrapper, error) {
+	network, address, err := ParseAPIURL(apiURL)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{}
+	dial := func(ctx context.Context) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, address)
+	}
+	return &apiWrapper{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dial(ctx)
+				},
+			},
+		},
+		dial:     dial,
+		logger:   logger,
+		timeouts: timeouts,
+		redactor: redactor{patterns: sensitivePatterns},
+	}, nil
+}
+
+// apiCall is a request to the libpod API.
+type apiCall struct {
+	method string
+	// path is the path of the endpoint, relative to the API base path.
+	path   string
+	query  url.Values
+	header http.Header
+	body   []byte
+	// secrets are masked in the errors, in addition to the sensitive patterns.
+	secrets []string
+}
+
+// url returns the URL of the endpoint. The host is ignored, since the
+// connections are always dialed to the API address.
+func (c apiCall) url() string {
+	return (&url.URL{Scheme: "http", Host: "podman", Path: apiBasePath + c.path, RawQuery: c.query.Encode()}).String()
+}
+
+// request sends the call, returning an *APIError for error responses.
+func (p *apiWrapper) request(ctx context.Context, c apiCall) (*http.Response, error) {
+	var body io.Reader
+	if c.body != nil {
+		body = bytes.NewReader(c.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, c.method, c.url(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range c.header {
+		req.Header[name] = values
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer func() { _ = resp.Body.Close() }()
+		return nil, p.readAPIError(resp, c.secrets)
+	}
+	return resp, nil
+}
+
+// readAPIError decodes the error response, masking the secrets in the message.
+func (p *apiWrapper) readAPIError(resp *http.Response, secrets []string) error {
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, maxAPIErrorSize))
+	apiErr := &APIError{}
+	if err := json.Unmarshal(content, apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(content))
+	}
+	apiErr.StatusCode = resp.StatusCode
+	apiErr.Message = p.redactor.redactText(apiErr.Message, secrets)
+	return apiErr
+}
+
+// call sends the call and decodes the JSON response into out, unless out is nil.
+func (p *apiWrapper) call(ctx context.Context, msg string, c apiCall, out any) error {
+	p.logger.Debugf("%s with request %s %s", msg, c.method, c.path)
+	resp, err := p.request(ctx, c)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s cancelled (%w)", msg, ctx.Err())
+		}
+		return fmt.Errorf("error while %s (%w)", msg, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode the response while %s (%w)", msg, err)
+	}
+	return nil
+}
+
+// callWithTimeout sends the call like call, but returns a TimeoutError naming
+// the equivalent podman subcommand if it does not finish within the timeout.
+func (p *apiWrapper) callWithTimeout(
+	ctx context.Context,
+	timeout time.Duration,
+	subcommand string,
+	msg string,
+	c apiCall,
+	out any,
+) error {
+	callCtx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	err := p.call(callCtx, msg, c, out)
+	if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{Subcommand: subcommand, Timeout: timeout}
+	}
+	return err
+}
+
+func (p *apiWrapper) Version(ctx context.Context) (*VersionInfo, error) {
+	var version struct {
+		Version string `json:"Version"`
+	}
+	if err := p.callWithTimeout(ctx, p.timeouts.Probe, "version", "getting the podman version", apiCall{
+		method: http.MethodGet,
+		path:   "/version",
+	}, &version); err != nil {
+		return nil, err
+	}
+	return &VersionInfo{Server: version.Version}, nil
+}
+
+func (p *apiWrapper) Info(ctx context.Context) (*HostInfo, error) {
+	var output infoOutput
+	if err := p.callWithTimeout(ctx, p.timeouts.Probe, "info", "getting the podman host information", apiCall{
+		method: http.MethodGet,
+		path:   "/info",
+	}, &output); err != nil {
+		return nil, err
+	}
+	return output.hostInfo(), nil
+}
+
+func (p *apiWrapper) ImageExists(ctx context.Context, image string) (*bool, error) {
+	err := p.call(ctx, "checking whether image exists", apiCall{
+		method: http.MethodGet,
+		path:   "/images/" + decorateImageName(image) + "/exists",
+	}, nil)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	exists := err == nil
+	return &exists, nil
+}
+
+// imageInspect is the part of the image inspection the wrapper uses.
+type imageInspect struct {
+	Digest      string   `json:"Digest"`
+	RepoDigests []string `json:"RepoDigests"`
+}
+
+func (p *apiWrapper) inspectImage(ctx context.Context, image string, msg string) (*imageInspect, error) {
+	var inspect imageInspect
+	if err := p.call(ctx, msg, apiCall{
+		method: http.MethodGet,
+		path:   "/images/" + decorateImageName(image) + "/json",
+	}, &inspect); err != nil {
+		return nil, err
+	}
+	return &inspect, nil
+}
+
+func (p *apiWrapper) ImageDigest(ctx context.Context, image string) (string, error) {
+	inspect, err := p.inspectImage(ctx, image, "inspecting image digest")
+	if err != nil {
+		return "", err
+	}
+	return inspect.Digest, nil
+}
+
+func (p *apiWrapper) ImageRepoDigests(ctx context.Context, image string) ([]string, error) {
+	inspect, err := p.inspectImage(ctx, image, "inspecting image repository digests")
+	if err != nil {
+		return nil, err
+	}
+	return inspect.RepoDigests, nil
+}
+
+// containerInspect is the part of the container inspection the wrapper uses.
+type containerInspect struct {
+	State           ContainerState `json:"State"`
+	NetworkSettings struct {
+		// Ports has no bindings for exposed ports which are not published.
+		Ports map[string][]struct {
+			HostIP   string `json:"HostIp"`
+			HostPort string `json:"HostPort"`
+		} `json:"Ports"`
+	} `json:"NetworkSettings"`
+}
+
+func (p *apiWrapper) inspectContainer(ctx context.Context, containerNameOrID string, msg string) (*containerInspect, error) {
+	var inspect containerInspect
+	err := p.call(ctx, msg, apiCall{method: http.MethodGet, path: "/containers/" + containerNameOrID + "/json"}, &inspect)
+	switch {
+	case isNotFound(err):
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchContainer, containerNameOrID)
+	case err != nil:
+		return nil, err
+	}
+	return &inspect, nil
+}
+
+func (p *apiWrapper) InspectContainer(ctx context.Context, containerNameOrID string) (*ContainerState, error) {
+	inspect, err := p.inspectContainer(ctx, containerNameOrID, "inspecting container "+containerNameOrID)
+	if err != nil {
+		return nil, err
+	}
+	return &inspect.State, nil
+}
+
+func (p *apiWrapper) Ports(ctx context.Context, containerNameOrID string) (nat.PortMap, error) {
+	inspect, err := p.inspectContainer(ctx, containerNameOrID, "listing the ports of container "+containerNameOrID)
+	if err != nil {
+		return nil, err
+	}
+	ports := nat.PortMap{}
+	for port, bindings := range inspect.NetworkSettings.Ports {
+		for _, binding := range bindings {
+			ports[nat.Port(port)] = append(ports[nat.Port(port)], nat.PortBinding{HostIP: binding.HostIP, HostPort: binding.HostPort})
+		}
+	}
+	return ports, nil
+}
+
+// pullReport is an entry of the progress stream of an image pull.
+type pullReport struct {
+	Stream string `json:"stream"`
+	Error  string `json:"error"`
+}
+
+func (p *apiWrapper) PullImage(ctx context.Context, image string, options PullOptions) error {
+	if options.CertDir != "" || options.SignaturePolicy != "" {
+		return errors.New("the podman API cannot pull with a certificate directory or a signature policy;" +
+			" use the CLI backend for them")
+	}
+	c := apiCall{
+		method: http.MethodPost,
+		path:   "/images/pull",
+		query:  url.Values{"reference": {decorateImageName(image)}},
+		header: http.Header{},
+	}
+	if options.Platform != nil {
+		platform := strings.SplitN(*options.Platform, "/", 3)
+		for i, name := range []string{"os", "arch", "variant"}[:len(platform)] {
+			c.query.Set(name, platform[i])
+		}
+	}
+	if options.TLSVerify != nil {
+		c.query.Set("tlsVerify", strconv.FormatBool(*options.TLSVerify))
+	}
+	if options.AuthFile != "" {
+		auth, err := registryAuthHeader(options.AuthFile)
+		if err != nil {
+			return err
+		}
+		c.header.Set("X-Registry-Auth", auth)
+	}
+
+	pullCtx, cancel := withTimeout(ctx, p.timeouts.ImagePull)
+	defer cancel()
+	err := p.pull(pullCtx, image, c)
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return fmt.Errorf("pulling image cancelled (%w)", ctx.Err())
+	case errors.Is(pullCtx.Err(), context.DeadlineExceeded):
+		return &TimeoutError{Subcommand: "pull", Timeout: p.timeouts.ImagePull}
+	}
+	return fmt.Errorf("error while pulling image %s (%w)", image, err)
+}
+
+// pull sends the pull request and follows its progress stream, which reports
+// the errors of the pull.
+func (p *apiWrapper) pull(ctx context.Context, image string, c apiCall) error {
+	p.logger.Debugf("pulling image %s with request %s %s", image, c.method, c.path)
+	resp, err := p.request(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var report pullReport
+		if err := decoder.Decode(&report); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if report.Error != "" {
+			return errors.New(p.redactor.redactText(report.Error, nil))
+		}
+		if report.Stream != "" {
+			p.logger.Debugf("%s", strings.TrimSpace(report.Stream))
+		}
+	}
+}
+
+// registryAuthConfig are the credentials of a registry in the X-Registry-Auth header.
+type registryAuthConfig struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+// registryAuthHeader converts the containers-auth.json file into the
+// X-Registry-Auth header, which holds the credentials keyed by registry.
+func registryAuthHeader(authFile string) (string, error) {
+	content, err := os.ReadFile(authFile) //nolint:gosec // the path is configured by the user
+	if err != nil {
+		return "", fmt.Errorf("failed to read the authentication file %s (%w)", authFile, err)
+	}
+	var file struct {
+		Auths map[string]struct {
+			Auth          string `json:"auth"`
+			IdentityToken string `json:"identitytoken"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return "", fmt.Errorf("failed to decode the authentication file %s (%w)", authFile, err)
+	}
+	configs := make(map[string]registryAuthConfig, len(file.Auths))
+	for host, entry := range file.Auths {
+		config := registryAuthConfig{IdentityToken: entry.IdentityToken}
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return "", fmt.Errorf("invalid credentials of registry %s in the authentication file %s (%w)", host, authFile, err)
+			}
+			config.Username, config.Password, _ = strings.Cut(string(decoded), ":")
+		}
+		configs[host] = config
+	}
+	encoded, err := json.Marshal(configs)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(encoded), nil
+}
+
+func (p *apiWrapper) Kill(ctx context.Context, containerName string) error {
+	err := p.signal(ctx, containerName, "KILL", "killing container "+containerName)
+	var timeoutErr *TimeoutError
+	switch {
+	case errors.As(err, &timeoutErr):
+		return err
+	case err != nil:
+		p.logger.Warningf("failed to kill pod %s (%s); it may have exited earlier", containerName, err.Error())
+	default:
+		p.logger.Debugf("successfully killed container %s", containerName)
+	}
+	return nil
+}
+
+func (p *apiWrapper) Stop(ctx context.Context, containerName string, signal string, timeout time.Duration) (bool, error) {
+	if err := p.signal(ctx, containerName, signal, "sending "+signal+" to container "+containerName); err != nil {
+		var timeoutErr *TimeoutError
+		if errors.As(err, &timeoutErr) {
+			return false, err
+		}
+		// The container most likely exited in the meantime, which the
+		// state check confirms.
+		p.logger.Debugf("failed to send %s to container %s (%s)", signal, containerName, err.Error())
+	}
+	return waitForStop(ctx, p, containerName, timeout)
+}
+
+func (p *apiWrapper) signal(ctx context.Context, containerName string, signal string, msg string) error {
+	return p.callWithTimeout(ctx, p.timeouts.Kill, "kill", msg, apiCall{
+		method: http.MethodPost,
+		path:   "/containers/" + containerName + "/kill",
+		query:  url.Values{"signal": {signal}},
+	}, nil)
+}
+
+func (p *apiWrapper) Clean(ctx context.Context, containerName string) error {
+	err := p.callWithTimeout(ctx, p.timeouts.Remove, "rm", "removing container "+containerName, apiCall{
+		method: http.MethodDelete,
+		path:   "/containers/" + containerName,
+		query:  url.Values{"force": {"true"}},
+	}, nil)
+	var timeoutErr *TimeoutError
+	switch {
+	case errors.As(err, &timeoutErr):
+		return err
+	case isNotFound(err):
+		p.logger.Debugf("container %s was already removed", containerName)
+	case err != nil:
+		p.logger.Errorf(err.Error())
+	default:
+		p.logger.Debugf("successfully removed container %s", containerName)
+	}
+	return nil
+}
+
+func (p *apiWrapper) CreateSecret(ctx context.Context, name string, value []byte) error {
+	return p.callWithTimeout(ctx, p.timeouts.SecretCreate, "secret", "creating secret "+name, apiCall{
+		method:  http.MethodPost,
+		path:    "/secrets/create",
+		query:   url.Values{"name": {name}},
+		body:    value,
+		secrets: []string{string(value)},
+	}, nil)
+}
+
+func (p *apiWrapper) RemoveSecret(ctx context.Context, name string) error {
+	return p.callWithTimeout(ctx, p.timeouts.Remove, "secret", "removing secret "+name, apiCall{
+		method: http.MethodDelete,
+		path:   "/secrets/" + name,
+	}, nil)
+}
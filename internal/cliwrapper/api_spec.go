@@ -0,0 +1,677 @@
+package cliwrapper
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// specGenerator is the subset of the libpod container specification which the
+// podman run flags of the deployer translate to.
+type specGenerator struct {
+	Name               string              `json:"name"`
+	Image              string              `json:"image"`
+	Command            []string            `json:"command,omitempty"`
+	Stdin              bool                `json:"stdin,omitempty"`
+	Hostname           string              `json:"hostname,omitempty"`
+	Sysctl             map[string]string   `json:"sysctl,omitempty"`
+	User               string              `json:"user,omitempty"`
+	Env                map[string]string   `json:"env,omitempty"`
+	Labels             map[string]string   `json:"labels,omitempty"`
+	Mounts             []specMount         `json:"mounts,omitempty"`
+	Volumes            []specNamedVolume   `json:"volumes,omitempty"`
+	ImageVolumes       []specImageVolume   `json:"image_volumes,omitempty"`
+	CgroupNS           *specNamespace      `json:"cgroupns,omitempty"`
+	NetNS              *specNamespace      `json:"netns,omitempty"`
+	Networks           map[string]struct{} `json:"Networks,omitempty"`
+	DNSServers         []string            `json:"dns_server,omitempty"`
+	DNSOptions         []string            `json:"dns_option,omitempty"`
+	DNSSearch          []string            `json:"dns_search,omitempty"`
+	HostAdd            []string            `json:"hostadd,omitempty"`
+	PortMappings       []specPortMapping   `json:"portmappings,omitempty"`
+	Privileged         bool                `json:"privileged,omitempty"`
+	CapAdd             []string            `json:"cap_add,omitempty"`
+	CapDrop            []string            `json:"cap_drop,omitempty"`
+	ResourceLimits     *specResources      `json:"resource_limits,omitempty"`
+	Rlimits            []specRlimit        `json:"r_limits,omitempty"`
+	UserNS             *specNamespace      `json:"userns,omitempty"`
+	IDMappings         *specIDMappings     `json:"idmappings,omitempty"`
+	Pod                string              `json:"pod,omitempty"`
+	Secrets            []specSecret        `json:"secrets,omitempty"`
+	SecretEnv          map[string]string   `json:"secret_env,omitempty"`
+	NoNewPrivileges    bool                `json:"no_new_privileges,omitempty"`
+	SelinuxOpts        []string            `json:"selinux_opts,omitempty"`
+	SeccompProfilePath string              `json:"seccomp_profile_path,omitempty"`
+	ApparmorProfile    string              `json:"apparmor_profile,omitempty"`
+	ReadWriteTmpfs     *bool               `json:"read_write_tmpfs,omitempty"`
+	SDNotifyMode       string              `json:"sdnotifyMode,omitempty"`
+	StopSignal         int                 `json:"stop_signal,omitempty"`
+}
+
+type specMount struct {
+	Destination string   `json:"destination"`
+	Type        string   `json:"type"`
+	Source      string   `json:"source"`
+	Options     []string `json:"options,omitempty"`
+}
+
+type specNamedVolume struct {
+	Name    string
+	Dest    string
+	Options []string
+}
+
+type specImageVolume struct {
+	Source      string
+	Destination string
+	ReadWrite   bool
+}
+
+type specNamespace struct {
+	NSMode string `json:"nsmode"`
+	Value  string `json:"value,omitempty"`
+}
+
+type specPortMapping struct {
+	HostIP        string `json:"host_ip,omitempty"`
+	ContainerPort uint16 `json:"container_port"`
+	HostPort      uint16 `json:"host_port,omitempty"`
+	Range         uint16 `json:"range,omitempty"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+type specResources struct {
+	Memory *specMemory `json:"memory,omitempty"`
+	CPU    *specCPU    `json:"cpu,omitempty"`
+	Pids   *specPids   `json:"pids,omitempty"`
+}
+
+type specMemory struct {
+	Limit *int64 `json:"limit,omitempty"`
+	Swap  *int64 `json:"swap,omitempty"`
+}
+
+type specCPU struct {
+	Shares *uint64 `json:"shares,omitempty"`
+	Quota  *int64  `json:"quota,omitempty"`
+	Period *uint64 `json:"period,omitempty"`
+	Cpus   string  `json:"cpus,omitempty"`
+}
+
+type specPids struct {
+	Limit int64 `json:"limit"`
+}
+
+type specRlimit struct {
+	Type string `json:"type"`
+	Hard uint64 `json:"hard"`
+	Soft uint64 `json:"soft"`
+}
+
+type specIDMappings struct {
+	UIDMap []specIDMap `json:"UIDMap,omitempty"`
+	GIDMap []specIDMap `json:"GIDMap,omitempty"`
+}
+
+type specIDMap struct {
+	ContainerID int `json:"container_id"`
+	HostID      int `json:"host_id"`
+	Size        int `json:"size"`
+}
+
+type specSecret struct {
+	Source string
+	Target string
+}
+
+// cpuPeriod is the CFS period the --cpus limit is converted with, like podman does.
+const cpuPeriod = 100000
+
+// apiRunBoolFlags translate the podman run flags without a value.
+var apiRunBoolFlags = map[string]func(spec *specGenerator, value bool){
+	"-i":                func(spec *specGenerator, value bool) { spec.Stdin = value },
+	"--interactive":     func(spec *specGenerator, value bool) { spec.Stdin = value },
+	"--privileged":      func(spec *specGenerator, value bool) { spec.Privileged = value },
+	"--read-only-tmpfs": func(spec *specGenerator, value bool) { spec.ReadWriteTmpfs = &value },
+}
+
+// apiRunFlags translate the podman run flags with a value. Other flags are
+// rejected, since the API cannot pass them through like the CLI does.
+var apiRunFlags = map[string]func(spec *specGenerator, value string) error{
+	"-a":       setAttach,
+	"--attach": setAttach,
+	"--name": func(spec *specGenerator, value string) error {
+		spec.Name = value
+		return nil
+	},
+	"--hostname": func(spec *specGenerator, value string) error {
+		spec.Hostname = value
+		return nil
+	},
+	"--domainname": func(spec *specGenerator, value string) error {
+		if spec.Sysctl == nil {
+			spec.Sysctl = map[string]string{}
+		}
+		spec.Sysctl["kernel.domainname"] = value
+		return nil
+	},
+	"-u":       setUser,
+	"--user":   setUser,
+	"-e":       setEnv,
+	"--env":    setEnv,
+	"-l":       setLabel,
+	"--label":  setLabel,
+	"-v":       setVolume,
+	"--volume": setVolume,
+	"--mount":  setMount,
+	"--cgroupns": func(spec *specGenerator, value string) error {
+		spec.CgroupNS = parseNamespace(value)
+		return nil
+	},
+	"--network": setNetwork,
+	"--net":     setNetwork,
+	"--dns": func(spec *specGenerator, value string) error {
+		spec.DNSServers = append(spec.DNSServers, value)
+		return nil
+	},
+	"--dns-option": func(spec *specGenerator, value string) error {
+		spec.DNSOptions = append(spec.DNSOptions, value)
+		return nil
+	},
+	"--dns-search": func(spec *specGenerator, value string) error {
+		spec.DNSSearch = append(spec.DNSSearch, value)
+		return nil
+	},
+	"--add-host": func(spec *specGenerator, value string) error {
+		spec.HostAdd = append(spec.HostAdd, value)
+		return nil
+	},
+	"-p":        setPublish,
+	"--publish": setPublish,
+	"--cap-add": func(spec *specGenerator, value string) error {
+		spec.CapAdd = append(spec.CapAdd, value)
+		return nil
+	},
+	"--cap-drop": func(spec *specGenerator, value string) error {
+		spec.CapDrop = append(spec.CapDrop, value)
+		return nil
+	},
+	"-m":       setMemory,
+	"--memory": setMemory,
+	"--memory-swap": func(spec *specGenerator, value string) error {
+		swap, err := strconv.ParseInt(value, 10, 64)
+		spec.memory().Swap = &swap
+		return err
+	},
+	"--cpus": func(spec *specGenerator, value string) error {
+		cpus, err := strconv.ParseFloat(value, 64)
+		quota := int64(math.Round(cpus * cpuPeriod))
+		period := uint64(cpuPeriod)
+		spec.cpu().Quota = &quota
+		spec.cpu().Period = &period
+		return err
+	},
+	"--cpu-shares": func(spec *specGenerator, value string) error {
+		shares, err := strconv.ParseUint(value, 10, 64)
+		spec.cpu().Shares = &shares
+		return err
+	},
+	"--cpuset-cpus": func(spec *specGenerator, value string) error {
+		spec.cpu().Cpus = value
+		return nil
+	},
+	"--pids-limit": func(spec *specGenerator, value string) error {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		spec.resources().Pids = &specPids{Limit: limit}
+		return err
+	},
+	"--ulimit": setUlimit,
+	"--userns": func(spec *specGenerator, value string) error {
+		spec.UserNS = parseNamespace(value)
+		return nil
+	},
+	"--uidmap":       func(spec *specGenerator, value string) error { return spec.addIDMap(value, false) },
+	"--gidmap":       func(spec *specGenerator, value string) error { return spec.addIDMap(value, true) },
+	"--pod":          setPod,
+	"--secret":       setSecret,
+	"--security-opt": setSecurityOpt,
+	"--sdnotify": func(spec *specGenerator, value string) error {
+		spec.SDNotifyMode = value
+		return nil
+	},
+	"--stop-signal": func(spec *specGenerator, value string) error {
+		signal, err := parseSignal(value)
+		spec.StopSignal = signal
+		return err
+	},
+}
+
+// newSpecGenerator translates the podman run arguments of a deployment into
+// the libpod container specification, rejecting the flags it cannot translate.
+func newSpecGenerator(podmanArgs []string, image string, containerName string, containerArgs []string) (*specGenerator, error) {
+	if len(podmanArgs) == 0 || podmanArgs[0] != "run" {
+		return nil, fmt.Errorf("expected podman run arguments, got %v", podmanArgs)
+	}
+	spec := &specGenerator{Name: containerName, Image: image, Command: containerArgs}
+	var errs []error
+	args := podmanArgs[1:]
+	for i := 0; i < len(args); i++ {
+		flag, value, hasValue := args[i], "", false
+		if strings.HasPrefix(flag, "--") {
+			flag, value, hasValue = strings.Cut(flag, "=")
+		}
+		if set, ok := apiRunBoolFlags[flag]; ok {
+			enabled := true
+			if hasValue {
+				var err error
+				if enabled, err = strconv.ParseBool(value); err != nil {
+					errs = append(errs, fmt.Errorf("invalid %s value %q (%w)", flag, value, err))
+					continue
+				}
+			}
+			set(spec, enabled)
+			continue
+		}
+		set, ok := apiRunFlags[flag]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("the podman run flag %s is not supported by the API backend", flag))
+			continue
+		case !hasValue && i+1 == len(args):
+			errs = append(errs, fmt.Errorf("the podman run flag %s has no value", flag))
+			continue
+		case !hasValue:
+			i++
+			value = args[i]
+		}
+		if err := set(spec, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s value %q (%w)", flag, value, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return spec, nil
+}
+
+func (spec *specGenerator) resources() *specResources {
+	if spec.ResourceLimits == nil {
+		spec.ResourceLimits = &specResources{}
+	}
+	return spec.ResourceLimits
+}
+
+func (spec *specGenerator) memory() *specMemory {
+	if spec.resources().Memory == nil {
+		spec.ResourceLimits.Memory = &specMemory{}
+	}
+	return spec.ResourceLimits.Memory
+}
+
+func (spec *specGenerator) cpu() *specCPU {
+	if spec.resources().CPU == nil {
+		spec.ResourceLimits.CPU = &specCPU{}
+	}
+	return spec.ResourceLimits.CPU
+}
+
+// addIDMap adds a mapping in the container_id:host_id:amount format.
+func (spec *specGenerator) addIDMap(value string, gid bool) error {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return errors.New("must have the container_id:host_id:amount format")
+	}
+	ids := make([]int, len(parts))
+	for i, part := range parts {
+		id, err := strconv.Atoi(part)
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+	}
+	if spec.IDMappings == nil {
+		spec.IDMappings = &specIDMappings{}
+	}
+	mapping := specIDMap{ContainerID: ids[0], HostID: ids[1], Size: ids[2]}
+	if gid {
+		spec.IDMappings.GIDMap = append(spec.IDMappings.GIDMap, mapping)
+	} else {
+		spec.IDMappings.UIDMap = append(spec.IDMappings.UIDMap, mapping)
+	}
+	return nil
+}
+
+// setAttach accepts the attached streams, which the API backend always attaches to.
+func setAttach(_ *specGenerator, value string) error {
+	switch value {
+	case "stdin", "stdout", "stderr":
+		return nil
+	}
+	return errors.New("must be stdin, stdout or stderr")
+}
+
+func setUser(spec *specGenerator, value string) error {
+	spec.User = value
+	return nil
+}
+
+// setEnv sets a variable, resolving variables without a value from the
+// environment of the deployer like the podman CLI does.
+func setEnv(spec *specGenerator, value string) error {
+	name, envValue, hasValue := strings.Cut(value, "=")
+	if !hasValue {
+		var set bool
+		if envValue, set = os.LookupEnv(name); !set {
+			return nil
+		}
+	}
+	if spec.Env == nil {
+		spec.Env = map[string]string{}
+	}
+	spec.Env[name] = envValue
+	return nil
+}
+
+func setLabel(spec *specGenerator, value string) error {
+	name, labelValue, _ := strings.Cut(value, "=")
+	if spec.Labels == nil {
+		spec.Labels = map[string]string{}
+	}
+	spec.Labels[name] = labelValue
+	return nil
+}
+
+// windowsPathPattern matches host paths with a Windows drive letter.
+var windowsPathPattern = regexp.MustCompile(`^[a-zA-Z]:[\\/]`)
+
+// setVolume translates a bind or named volume in the source:target[:options] format.
+func setVolume(spec *specGenerator, value string) error {
+	if windowsPathPattern.MatchString(value) {
+		return errors.New("only the podman CLI translates Windows paths")
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return errors.New("must have the source:target[:options] format")
+	}
+	var options []string
+	if len(parts) == 3 {
+		options = strings.Split(parts[2], ",")
+	}
+	if strings.HasPrefix(parts[0], "/") {
+		spec.Mounts = append(spec.Mounts, specMount{Type: "bind", Source: parts[0], Destination: parts[1], Options: options})
+	} else {
+		spec.Volumes = append(spec.Volumes, specNamedVolume{Name: parts[0], Dest: parts[1], Options: options})
+	}
+	return nil
+}
+
+// setMount translates a mount in the comma-separated format of podman run --mount.
+func setMount(spec *specGenerator, value string) error {
+	fields, err := csv.NewReader(strings.NewReader(value)).Read()
+	if err != nil {
+		return err
+	}
+	var mountType, source, target string
+	readOnly := false
+	var options []string
+	for _, field := range fields {
+		key, optionValue, _ := strings.Cut(field, "=")
+		switch key {
+		case "type":
+			mountType = optionValue
+		case "source", "src":
+			source = optionValue
+		case "target", "destination", "dst":
+			target = optionValue
+		case "readonly", "ro":
+			readOnly = optionValue == "" || optionValue == "true"
+		case "relabel":
+			relabel := map[string]string{"shared": "z", "private": "Z"}[optionValue]
+			if relabel == "" {
+				return fmt.Errorf("unknown relabel option %s", optionValue)
+			}
+			options = append(options, relabel)
+		case "bind-propagation":
+			options = append(options, optionValue)
+		case "tmpfs-size":
+			options = append(options, "size="+optionValue)
+		default:
+			return fmt.Errorf("unsupported mount option %s", key)
+		}
+	}
+	if readOnly {
+		options = append(options, "ro")
+	}
+	switch mountType {
+	case "bind":
+		if windowsPathPattern.MatchString(source) {
+			return errors.New("only the podman CLI translates Windows paths")
+		}
+		spec.Mounts = append(spec.Mounts, specMount{Type: "bind", Source: source, Destination: target, Options: options})
+	case "tmpfs":
+		spec.Mounts = append(spec.Mounts, specMount{Type: "tmpfs", Source: "tmpfs", Destination: target, Options: options})
+	case "volume":
+		spec.Volumes = append(spec.Volumes, specNamedVolume{Name: source, Dest: target, Options: options})
+	case "image":
+		spec.ImageVolumes = append(spec.ImageVolumes, specImageVolume{Source: source, Destination: target, ReadWrite: !readOnly})
+	default:
+		return fmt.Errorf("unsupported mount type %q", mountType)
+	}
+	return nil
+}
+
+// parseNamespace translates a namespace option, e.g. host, container:<name>, ns:<path> or keep-id:uid=1000.
+func parseNamespace(value string) *specNamespace {
+	mode, option, _ := strings.Cut(value, ":")
+	if mode == "ns" {
+		mode = "path"
+	}
+	return &specNamespace{NSMode: mode, Value: option}
+}
+
+func setNetwork(spec *specGenerator, value string) error {
+	mode, _, _ := strings.Cut(value, ":")
+	switch mode {
+	case "host", "none", "bridge", "private", "slirp4netns", "pasta", "container", "ns":
+		spec.NetNS = parseNamespace(value)
+	default:
+		// A named network, which is attached to through the bridge mode.
+		spec.NetNS = &specNamespace{NSMode: "bridge"}
+		if spec.Networks == nil {
+			spec.Networks = map[string]struct{}{}
+		}
+		spec.Networks[value] = struct{}{}
+	}
+	return nil
+}
+
+// setPublish translates a port binding in the [ip:][hostPort:]containerPort[/protocol] format, where the ports can
+// be ranges and IPv6 addresses are in brackets.
+func setPublish(spec *specGenerator, value string) error {
+	addresses, protocol, _ := strings.Cut(value, "/")
+	mapping := specPortMapping{Protocol: protocol}
+	if strings.HasPrefix(addresses, "[") {
+		end := strings.Index(addresses, "]")
+		if end < 0 {
+			return errors.New("unterminated IPv6 address")
+		}
+		mapping.HostIP = addresses[1:end]
+		addresses = strings.TrimPrefix(addresses[end+1:], ":")
+	}
+	parts := strings.Split(addresses, ":")
+	var hostPorts string
+	switch len(parts) {
+	case 1:
+	case 2:
+		hostPorts = parts[0]
+	case 3:
+		mapping.HostIP, hostPorts = parts[0], parts[1]
+	default:
+		return errors.New("must have the [ip:][hostPort:]containerPort format")
+	}
+	containerPort, containerRange, err := parsePortRange(parts[len(parts)-1])
+	if err != nil {
+		return err
+	}
+	mapping.ContainerPort, mapping.Range = containerPort, containerRange
+	if hostPorts != "" {
+		hostPort, hostRange, err := parsePortRange(hostPorts)
+		if err != nil {
+			return err
+		}
+		if hostRange != containerRange {
+			return errors.New("the host and container port ranges differ in size")
+		}
+		mapping.HostPort = hostPort
+	}
+	spec.PortMappings = append(spec.PortMappings, mapping)
+	return nil
+}
+
+// parsePortRange parses a port or a port range, returning the first port and the number of ports.
+func parsePortRange(value string) (uint16, uint16, error) {
+	first, last, isRange := strings.Cut(value, "-")
+	start, err := strconv.ParseUint(first, 10, 16)
+	if err != nil || !isRange {
+		return uint16(start), 1, err
+	}
+	end, err := strconv.ParseUint(last, 10, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("the port range %s is reversed", value)
+	}
+	return uint16(start), uint16(end - start + 1), nil
+}
+
+func setMemory(spec *specGenerator, value string) error {
+	limit, err := strconv.ParseInt(value, 10, 64)
+	spec.memory().Limit = &limit
+	return err
+}
+
+// setUlimit translates a limit in the name=soft[:hard] format.
+func setUlimit(spec *specGenerator, value string) error {
+	name, limits, found := strings.Cut(value, "=")
+	if !found {
+		return errors.New("must have the name=soft[:hard] format")
+	}
+	softValue, hardValue, hasHard := strings.Cut(limits, ":")
+	if !hasHard {
+		hardValue = softValue
+	}
+	soft, err := parseRlimit(softValue)
+	if err != nil {
+		return err
+	}
+	hard, err := parseRlimit(hardValue)
+	if err != nil {
+		return err
+	}
+	spec.Rlimits = append(spec.Rlimits, specRlimit{Type: "RLIMIT_" + strings.ToUpper(name), Soft: soft, Hard: hard})
+	return nil
+}
+
+// parseRlimit parses a resource limit, where -1 is unlimited.
+func parseRlimit(value string) (uint64, error) {
+	if value == "-1" {
+		return math.MaxUint64, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+func setPod(spec *specGenerator, value string) error {
+	if strings.HasPrefix(value, "new:") {
+		return errors.New("only the podman CLI creates pods")
+	}
+	spec.Pod = value
+	return nil
+}
+
+// setSecret translates a secret in the name[,type=mount|env][,target=target] format.
+func setSecret(spec *specGenerator, value string) error {
+	options := strings.Split(value, ",")
+	name := options[0]
+	secretType, target := "mount", name
+	for _, option := range options[1:] {
+		key, optionValue, _ := strings.Cut(option, "=")
+		switch key {
+		case "type":
+			secretType = optionValue
+		case "target":
+			target = optionValue
+		default:
+			return fmt.Errorf("unsupported secret option %s", key)
+		}
+	}
+	switch secretType {
+	case "mount":
+		spec.Secrets = append(spec.Secrets, specSecret{Source: name, Target: target})
+	case "env":
+		if spec.SecretEnv == nil {
+			spec.SecretEnv = map[string]string{}
+		}
+		spec.SecretEnv[target] = name
+	default:
+		return fmt.Errorf("unsupported secret type %s", secretType)
+	}
+	return nil
+}
+
+func setSecurityOpt(spec *specGenerator, value string) error {
+	key, option, _ := strings.Cut(value, "=")
+	switch key {
+	case "no-new-privileges":
+		spec.NoNewPrivileges = option == "" || option == "true"
+	case "label":
+		spec.SelinuxOpts = append(spec.SelinuxOpts, option)
+	case "seccomp":
+		spec.SeccompProfilePath = option
+	case "apparmor":
+		spec.ApparmorProfile = option
+	default:
+		return fmt.Errorf("unsupported security option %s", key)
+	}
+	return nil
+}
+
+// linuxSignals are the numbers of the standard Linux signals. The podman
+// service always runs on Linux, whatever the platform of the deployer.
+var linuxSignals = map[string]int{
+	"HUP": 1, "INT": 2, "QUIT": 3, "ILL": 4, "TRAP": 5, "ABRT": 6, "IOT": 6, "BUS": 7, "FPE": 8, "KILL": 9,
+	"USR1": 10, "SEGV": 11, "USR2": 12, "PIPE": 13, "ALRM": 14, "TERM": 15, "STKFLT": 16, "CHLD": 17, "CLD": 17,
+	"CONT": 18, "STOP": 19, "TSTP": 20, "TTIN": 21, "TTOU": 22, "URG": 23, "XCPU": 24, "XFSZ": 25, "VTALRM": 26,
+	"PROF": 27, "WINCH": 28, "IO": 29, "POLL": 29, "PWR": 30, "SYS": 31, "RTMIN": 34, "RTMAX": 64,
+}
+
+// signalPattern matches signal names with an optional offset, e.g. SIGRTMIN+3, and signal numbers.
+var signalPattern = regexp.MustCompile(`^(?:SIG)?([A-Z][A-Z0-9]*)([+-][0-9]+)?$`)
+
+// parseSignal resolves a signal name or number to the Linux signal number.
+func parseSignal(value string) (int, error) {
+	if number, err := strconv.Atoi(value); err == nil {
+		return number, nil
+	}
+	match := signalPattern.FindStringSubmatch(strings.ToUpper(value))
+	if match == nil {
+		return 0, errors.New("unknown signal")
+	}
+	number, known := linuxSignals[match[1]]
+	if !known {
+		return 0, errors.New("unknown signal")
+	}
+	if match[2] != "" {
+		offset, err := strconv.Atoi(match[2])
+		if err != nil {
+			return 0, err
+		}
+		number += offset
+	}
+	return number, nil
+}
@@ -0,0 +1,255 @@
+package cliwrapper
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Stream numbers of the multiplexed attach stream.
+const (
+	attachStdout = 1
+	attachStderr = 2
+)
+
+func (p *apiWrapper) Deploy(
+	ctx context.Context,
+	image string,
+	containerName string,
+	podmanArgs []string,
+	containerArgs []string,
+) (Process, error) {
+	redactedArgs, secrets := p.redactor.redactArgs(podmanArgs)
+	p.logger.Debugf("Deploying through the podman API with arguments %v", redactedArgs)
+	spec, err := newSpecGenerator(podmanArgs, decorateImageName(image), containerName, containerArgs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to translate the podman run arguments of container %s (%w)", containerName, err)
+	}
+	body, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.call(ctx, "creating container "+containerName, apiCall{
+		method:  http.MethodPost,
+		path:    "/containers/create",
+		header:  http.Header{"Content-Type": {"application/json"}},
+		body:    body,
+		secrets: secrets,
+	}, nil); err != nil {
+		return nil, err
+	}
+	// Attaching before starting the container ensures that no output is lost.
+	conn, stream, err := p.attach(ctx, containerName)
+	if err != nil {
+		if cleanErr := p.Clean(context.Background(), containerName); cleanErr != nil {
+			p.logger.Warningf("failed to remove container %s (%s)", containerName, cleanErr.Error())
+		}
+		return nil, err
+	}
+
+	stdout, stdoutWriter := io.Pipe()
+	stderr, stderrWriter := io.Pipe()
+	process := &podmanProcess{
+		stdin:      attachStdin{Conn: conn},
+		stderr:     newRingBuffer(stderrTailLines),
+		stderrDone: make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go func() {
+		err := demultiplex(stream, stdoutWriter, stderrWriter)
+		if errors.Is(err, net.ErrClosed) {
+			// The deployment was stopped, which ends the output like killing
+			// the podman process does.
+			err = nil
+		}
+		_ = stdoutWriter.CloseWithError(err)
+		_ = stderrWriter.CloseWithError(err)
+		_ = conn.Close()
+	}()
+	go process.captureStderr(stderr, p.logger.WithLabel("container", containerName), func(line string) string {
+		return p.redactor.redactText(line, secrets)
+	})
+
+	if err := p.start(ctx, containerName); err != nil {
+		p.stopDeployment(conn, containerName)
+		_ = stdout.Close()
+		select {
+		case <-process.stderrDone:
+		case <-time.After(stderrDrainTimeout):
+		}
+		if stderrTail := process.Stderr(); stderrTail != "" {
+			return nil, fmt.Errorf("%w; stderr:\n%s", err, stderrTail)
+		}
+		return nil, err
+	}
+	go p.wait(containerName, process)
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.logger.Infof("context done (%s); killing container %s", ctx.Err(), containerName)
+			p.stopDeployment(conn, containerName)
+		case <-process.done:
+		}
+	}()
+	process.stdout = &stdoutReader{
+		ReadCloser: newHandshakeReader(stdout, p.timeouts.ATPHandshake, func() {
+			p.logger.Errorf("no output from container %s within %s; killing it", containerName, p.timeouts.ATPHandshake)
+			p.stopDeployment(conn, containerName)
+		}),
+		stderrDone: process.stderrDone,
+	}
+	return process, nil
+}
+
+// start starts the created container, bounded by the container start timeout.
+func (p *apiWrapper) start(ctx context.Context, containerName string) error {
+	err := p.callWithTimeout(ctx, p.timeouts.ContainerStart, "start", "starting container "+containerName, apiCall{
+		method: http.MethodPost,
+		path:   "/containers/" + containerName + "/start",
+	}, nil)
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		timeoutErr.WaitingFor = "container " + containerName + " to start"
+	}
+	return err
+}
+
+// attach attaches to the streams of the container. The API upgrades the
+// connection of the attach request to a raw stream, so the request is written
+// to a dedicated connection which is returned along with the buffered stream.
+func (p *apiWrapper) attach(ctx context.Context, containerName string) (net.Conn, *bufio.Reader, error) {
+	msg := "attaching to container " + containerName
+	c := apiCall{
+		method: http.MethodPost,
+		path:   "/containers/" + containerName + "/attach",
+		query:  url.Values{"stdin": {"true"}, "stdout": {"true"}, "stderr": {"true"}, "stream": {"true"}},
+	}
+	p.logger.Debugf("%s with request %s %s", msg, c.method, c.path)
+	conn, err := p.dial(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error while %s (%w)", msg, err)
+	}
+	stream, err := p.upgrade(ctx, conn, c)
+	if err != nil {
+		_ = conn.Close()
+		if ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("%s cancelled (%w)", msg, ctx.Err())
+		}
+		return nil, nil, fmt.Errorf("error while %s (%w)", msg, err)
+	}
+	return conn, stream, nil
+}
+
+// upgrade sends the request on the connection and reads the response, which
+// must switch the connection to the raw stream.
+func (p *apiWrapper) upgrade(ctx context.Context, conn net.Conn, c apiCall) (*bufio.Reader, error) {
+	req, err := http.NewRequestWithContext(ctx, c.method, c.url(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	// The request context does not apply to raw connections.
+	stopDeadline := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stopDeadline()
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	stream := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(stream, req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusSwitchingProtocols, http.StatusOK:
+	default:
+		defer func() { _ = resp.Body.Close() }()
+		return nil, p.readAPIError(resp, nil)
+	}
+	if !stopDeadline() {
+		return nil, ctx.Err()
+	}
+	return stream, nil
+}
+
+// demultiplex splits the attach stream into the stdout and stderr of the
+// container. Each frame of the stream has an 8 byte header, holding the stream
+// number in the first byte and the big-endian payload size in the last four.
+func demultiplex(stream io.Reader, stdout io.Writer, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(stream, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		out := io.Discard
+		switch header[0] {
+		case attachStdout:
+			out = stdout
+		case attachStderr:
+			out = stderr
+		}
+		if _, err := io.CopyN(out, stream, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return err
+		}
+	}
+}
+
+// attachStdin is the stdin of an attached container. Closing it only closes
+// the write side of the connection, so that the output can still be read.
+type attachStdin struct {
+	net.Conn
+}
+
+func (s attachStdin) Close() error {
+	if conn, ok := s.Conn.(interface{ CloseWrite() error }); ok {
+		return conn.CloseWrite()
+	}
+	return nil
+}
+
+// wait waits for the container to exit and records its exit status on the
+// process.
+func (p *apiWrapper) wait(containerName string, process *podmanProcess) {
+	defer close(process.done)
+	ctx := context.Background()
+	var exitCode int
+	if err := p.call(ctx, "waiting for container "+containerName, apiCall{
+		method: http.MethodPost,
+		path:   "/containers/" + containerName + "/wait",
+		query:  url.Values{"condition": {"exited"}},
+	}, &exitCode); err != nil {
+		p.logger.Debugf("failed to wait for container %s (%s)", containerName, err.Error())
+		process.exitStatus = &ExitStatus{ExitCode: -1}
+		return
+	}
+	status := exitStatusFromCode(exitCode)
+	if !status.Success() {
+		inspectCtx, cancel := withTimeout(ctx, p.timeouts.Kill)
+		defer cancel()
+		if state, err := p.InspectContainer(inspectCtx, containerName); err == nil {
+			status.OOMKilled = state.OOMKilled
+		}
+	}
+	p.logger.Debugf("container %s %s", containerName, status)
+	process.exitStatus = status
+}
+
+// stopDeployment removes the container, which kills it, and closes the attach
+// connection.
+func (p *apiWrapper) stopDeployment(conn net.Conn, containerName string) {
+	if err := p.Clean(context.Background(), containerName); err != nil {
+		p.logger.Warningf("failed to remove container %s (%s)", containerName, err.Error())
+	}
+	_ = conn.Close()
+}
@@ -0,0 +1,510 @@
+package cliwrapper_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	log "go.arcalot.io/log/v2"
+
+	"go.arcalot.io/assert"
+	"go.flow.arcalot.io/podmandeployer/internal/cliwrapper"
+	"go.flow.arcalot.io/podmandeployer/tests"
+)
+
+const fakeAPIPrefix = "/v4.0.0/libpod"
+
+// fakeAPI is a stand-in for the libpod API of a podman service. Its containers
+// echo their stdin to stdout and exit once stdin is closed.
+type fakeAPI struct {
+	lock       sync.Mutex
+	requests   []string
+	specs      map[string]map[string]any
+	states     map[string]string
+	exited     map[string]chan struct{}
+	secrets    map[string]string
+	pullHeader http.Header
+	pullError  string
+}
+
+// startFakeAPI serves the stand-in API on a unix socket, returning its URL.
+func startFakeAPI(t *testing.T) (*fakeAPI, string) {
+	api := &fakeAPI{
+		specs:   map[string]map[string]any{},
+		states:  map[string]string{},
+		exited:  map[string]chan struct{}{},
+		secrets: map[string]string{},
+	}
+	// Unix socket paths are limited in length, which t.TempDir() may exceed.
+	dir, err := os.MkdirTemp("", "podman-api")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "podman.sock")
+	listener, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+	server := &http.Server{Handler: api, ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { _ = server.Close() })
+	return api, "unix://" + socket
+}
+
+func (a *fakeAPI) Requests() []string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return append([]string{}, a.requests...)
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.lock.Lock()
+	a.requests = append(a.requests, r.Method+" "+r.URL.RequestURI())
+	a.lock.Unlock()
+	path, found := strings.CutPrefix(r.URL.Path, fakeAPIPrefix)
+	if !found {
+		writeAPIError(w, http.StatusNotFound, "unknown API version")
+		return
+	}
+	switch {
+	case path == "/version":
+		_, _ = w.Write([]byte(`{"Version":"5.0.2","ApiVersion":"1.41"}`))
+	case path == "/info":
+		_, _ = w.Write([]byte(tests.FakePodmanInfo))
+	case strings.HasPrefix(path, "/images/"):
+		a.serveImage(w, r, strings.TrimPrefix(path, "/images/"))
+	case path == "/containers/create":
+		a.createContainer(w, r)
+	case strings.HasPrefix(path, "/containers/"):
+		name, action, _ := strings.Cut(strings.TrimPrefix(path, "/containers/"), "/")
+		a.serveContainer(w, r, name, action)
+	case path == "/secrets/create":
+		value, _ := io.ReadAll(r.Body)
+		if strings.HasPrefix(string(value), "invalid") {
+			writeAPIError(w, http.StatusInternalServerError, "invalid secret value "+string(value))
+			return
+		}
+		if strings.HasPrefix(string(value), "slow") {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+			return
+		}
+		a.lock.Lock()
+		a.secrets[r.URL.Query().Get("name")] = string(value)
+		a.lock.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case strings.HasPrefix(path, "/secrets/"):
+		a.lock.Lock()
+		delete(a.secrets, strings.TrimPrefix(path, "/secrets/"))
+		a.lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeAPIError(w, http.StatusNotFound, "unknown endpoint")
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"cause": message, "message": message, "response": status})
+}
+
+func (a *fakeAPI) serveImage(w http.ResponseWriter, r *http.Request, path string) {
+	switch {
+	case path == "pull":
+		a.lock.Lock()
+		a.pullHeader = r.Header.Clone()
+		pullError := a.pullError
+		a.lock.Unlock()
+		_, _ = fmt.Fprintln(w, `{"stream":"Trying to pull quay.io/arcalot/echo:latest...\n"}`)
+		if pullError != "" {
+			_, _ = fmt.Fprintf(w, `{"error":%q}`+"\n", pullError)
+		}
+	case path == "quay.io/arcalot/echo:latest/exists":
+		w.WriteHeader(http.StatusNoContent)
+	case path == "quay.io/arcalot/echo:latest/json":
+		_, _ = fmt.Fprint(w, `{"Digest":"sha256:1111","RepoDigests":["quay.io/arcalot/echo@sha256:2222"]}`)
+	default:
+		writeAPIError(w, http.StatusNotFound, "no such image")
+	}
+}
+
+func (a *fakeAPI) createContainer(w http.ResponseWriter, r *http.Request) {
+	var spec map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	name := spec["name"].(string)
+	a.lock.Lock()
+	a.specs[name] = spec
+	a.states[name] = "created"
+	a.exited[name] = make(chan struct{})
+	a.lock.Unlock()
+	w.WriteHeader(http.StatusCreated)
+	_, _ = fmt.Fprintf(w, `{"Id":"%s_id","Warnings":[]}`, name)
+}
+
+func (a *fakeAPI) serveContainer(w http.ResponseWriter, r *http.Request, name string, action string) {
+	a.lock.Lock()
+	state, exists := a.states[name]
+	exited := a.exited[name]
+	a.lock.Unlock()
+	if !exists {
+		writeAPIError(w, http.StatusNotFound, "no container with name or ID "+name+" found: no such container")
+		return
+	}
+	switch action {
+	case "attach":
+		a.attach(w, name)
+	case "start":
+		a.setState(name, "running")
+		w.WriteHeader(http.StatusNoContent)
+	case "wait":
+		<-exited
+		_, _ = fmt.Fprint(w, "0")
+	case "json":
+		_, _ = fmt.Fprintf(w, `{"State":{"Status":%q,"Running":%t},"NetworkSettings":{"Ports":{`+
+			`"8080/tcp":[{"HostIp":"0.0.0.0","HostPort":"18080"}],"9000/udp":null}}}`, state, state == "running")
+	case "kill":
+		a.exit(name)
+		w.WriteHeader(http.StatusNoContent)
+	case "":
+		a.exit(name)
+		a.lock.Lock()
+		delete(a.states, name)
+		a.lock.Unlock()
+		_, _ = fmt.Fprint(w, "[]")
+	default:
+		writeAPIError(w, http.StatusNotFound, "unknown endpoint")
+	}
+}
+
+func (a *fakeAPI) setState(name string, state string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.states[name] = state
+}
+
+func (a *fakeAPI) exit(name string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	select {
+	case <-a.exited[name]:
+	default:
+		a.states[name] = "exited"
+		close(a.exited[name])
+	}
+}
+
+// attach upgrades the connection and echoes each line of stdin to stdout,
+// writing the frames of the multiplexed stream.
+func (a *fakeAPI) attach(w http.ResponseWriter, name string) {
+	conn, buffered, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	_, _ = fmt.Fprint(conn, "HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.multiplexed-stream\r\n"+
+		"Connection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+	writeFrame(conn, 2, "echo started\n")
+	reader := bufio.NewReader(buffered)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			writeFrame(conn, 1, line)
+		}
+		if err != nil {
+			break
+		}
+	}
+	a.exit(name)
+}
+
+func writeFrame(w io.Writer, stream byte, payload string) {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload))) //nolint:gosec // test payloads are short
+	_, _ = w.Write(append(header, payload...))
+}
+
+func newAPIWrapper(t *testing.T, apiURL string, logger log.Logger) cliwrapper.CliWrapper {
+	podman, err := cliwrapper.NewAPIWrapper(apiURL, logger, cliwrapper.Timeouts{ContainerStart: 10 * time.Second}, nil)
+	assert.NoError(t, err)
+	return podman
+}
+
+func TestAPI_Deploy(t *testing.T) {
+	api, apiURL := startFakeAPI(t)
+	logs := log.NewBufferWriter()
+	podman := newAPIWrapper(t, apiURL, log.NewLogger(log.LevelDebug, logs))
+
+	process, err := podman.Deploy(
+		context.Background(),
+		"quay.io/arcalot/echo",
+		"echo_container",
+		[]string{"run", "-i", "-a", "stdin", "-a", "stdout", "-a", "stderr", "--name", "echo_container",
+			"-e", "API_TOKEN=s3cr3t", "--memory", "1048576"},
+		[]string{"--atp"},
+	)
+	assert.NoError(t, err)
+	_, err = process.Stdin().Write([]byte("ping\n"))
+	assert.NoError(t, err)
+	reader := bufio.NewReader(process.Stdout())
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equals(t, line, "ping\n")
+
+	// Closing stdin only half-closes the connection, so the end of the output
+	// can still be read.
+	assert.NoError(t, process.Stdin().Close())
+	_, err = reader.ReadString('\n')
+	assert.Equals(t, errors.Is(err, io.EOF), true)
+	select {
+	case <-process.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("container did not exit")
+	}
+	assert.Equals(t, process.ExitStatus().Success(), true)
+	assert.Equals(t, process.Stderr(), "echo started")
+
+	spec := api.specs["echo_container"]
+	assert.Equals(t, spec["image"], any("quay.io/arcalot/echo:latest"))
+	assert.Equals(t, spec["stdin"], any(true))
+	assert.Equals(t, spec["command"], any([]any{"--atp"}))
+	assert.Equals(t, spec["env"], any(map[string]any{"API_TOKEN": "s3cr3t"}))
+	assert.Equals(t, spec["resource_limits"], any(map[string]any{"memory": map[string]any{"limit": float64(1048576)}}))
+	requests := api.Requests()
+	assert.Equals(t, requests[0], "POST /v4.0.0/libpod/containers/create")
+	assert.Equals(t, strings.HasPrefix(requests[1], "POST /v4.0.0/libpod/containers/echo_container/attach?"), true)
+	assert.Equals(t, requests[2], "POST /v4.0.0/libpod/containers/echo_container/start")
+	assert.Equals(t, strings.Contains(logs.String(), "s3cr3t"), false)
+}
+
+func TestAPI_DeploySpec(t *testing.T) {
+	api, apiURL := startFakeAPI(t)
+	podman := newAPIWrapper(t, apiURL, log.NewTestLogger(t))
+
+	process, err := podman.Deploy(context.Background(), "quay.io/arcalot/echo", "spec_container", []string{
+		"run", "-i",
+		"-v", "/srv/data:/data:ro,z",
+		"--mount", "type=volume,source=cache,target=/cache",
+		"--mount", "type=tmpfs,target=/scratch,tmpfs-size=64m",
+		"--network", "plugins",
+		"-p", "127.0.0.1:8080-8081:80-81/tcp",
+		"--cpus=1.5",
+		"--ulimit", "nofile=1024:2048",
+		"--userns", "keep-id:uid=1000",
+		"--secret", "spec_container_token,type=env,target=TOKEN",
+		"--security-opt", "no-new-privileges",
+		"--stop-signal", "SIGRTMIN+3",
+	}, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, process.Stdin().Close())
+	<-process.Done()
+
+	spec, err := json.Marshal(api.specs["spec_container"])
+	assert.NoError(t, err)
+	for _, expected := range []string{
+		`"mounts":[{"destination":"/data","options":["ro","z"],"source":"/srv/data","type":"bind"},` +
+			`{"destination":"/scratch","options":["size=64m"],"source":"tmpfs","type":"tmpfs"}]`,
+		`"volumes":[{"Dest":"/cache","Name":"cache","Options":null}]`,
+		`"netns":{"nsmode":"bridge"}`,
+		`"Networks":{"plugins":{}}`,
+		`"portmappings":[{"container_port":80,"host_ip":"127.0.0.1","host_port":8080,"protocol":"tcp","range":2}]`,
+		`"cpu":{"period":100000,"quota":150000}`,
+		`"r_limits":[{"hard":2048,"soft":1024,"type":"RLIMIT_NOFILE"}]`,
+		`"userns":{"nsmode":"keep-id","value":"uid=1000"}`,
+		`"secret_env":{"TOKEN":"spec_container_token"}`,
+		`"no_new_privileges":true`,
+		`"stop_signal":37`,
+	} {
+		assert.Contains(t, string(spec), expected)
+	}
+}
+
+func TestAPI_DeployUnsupportedFlags(t *testing.T) {
+	api, apiURL := startFakeAPI(t)
+	podman := newAPIWrapper(t, apiURL, log.NewTestLogger(t))
+
+	_, err := podman.Deploy(context.Background(), "quay.io/arcalot/echo", "unsupported_container", []string{
+		"run", "-i", "--mac-address", "92:d0:c6:0a:29:33", "--pod", "new:plugins", "--memory", "lots",
+	}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "the podman run flag --mac-address is not supported by the API backend")
+	assert.Contains(t, err.Error(), `invalid --pod value "new:plugins" (only the podman CLI creates pods)`)
+	assert.Contains(t, err.Error(), `invalid --memory value "lots"`)
+	// Nothing is created if the arguments cannot be translated.
+	assert.Equals(t, len(api.Requests()), 0)
+}
+
+func TestAPI_DeployContextCancelled(t *testing.T) {
+	api, apiURL := startFakeAPI(t)
+	podman := newAPIWrapper(t, apiURL, log.NewTestLogger(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	process, err := podman.Deploy(ctx, "quay.io/arcalot/echo", "cancelled_container", []string{"run", "-i"}, nil)
+	assert.NoError(t, err)
+	cancel()
+	select {
+	case <-process.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("container was not stopped when the context was cancelled")
+	}
+	_, err = io.ReadAll(process.Stdout())
+	assert.NoError(t, err)
+	assert.SliceContains(t, "DELETE /v4.0.0/libpod/containers/cancelled_container?force=true", api.Requests())
+}
+
+func TestAPI_Images(t *testing.T) {
+	api, apiURL := startFakeAPI(t)
+	podman := newAPIWrapper(t, apiURL, log.NewTestLogger(t))
+	ctx := context.Background()
+
+	exists, err := podman.ImageExists(ctx, "quay.io/arcalot/echo")
+	assert.NoError(t, err)
+	assert.Equals(t, *exists, true)
+	exists, err = podman.ImageExists(ctx, "quay.io/arcalot/missing")
+	assert.NoError(t, err)
+	assert.Equals(t, *exists, false)
+	digest, err := podman.ImageDigest(ctx, "quay.io/arcalot/echo")
+	assert.NoError(t, err)
+	assert.Equals(t, digest, "sha256:1111")
+	repoDigests, err := podman.ImageRepoDigests(ctx, "quay.io/arcalot/echo")
+	assert.NoError(t, err)
+	assert.Equals(t, repoDigests, []string{"quay.io/arcalot/echo@sha256:2222"})
+
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	assert.NoError(t, os.WriteFile(authFile, []byte(`{"auths":{"quay.io":{"auth":"cm9ib3Q6aHVudGVyMg=="}}}`), 0600))
+	platform := "linux/arm64/v8"
+	tlsVerify := false
+	assert.NoError(t, podman.PullImage(ctx, "quay.io/arcalot/echo", cliwrapper.PullOptions{
+		Platform:  &platform,
+		AuthFile:  authFile,
+		TLSVerify: &tlsVerify,
+	}))
+	assert.SliceContains(
+		t,
+		"POST /v4.0.0/libpod/images/pull?arch=arm64&os=linux&reference=quay.io%2Farcalot%2Fecho%3Alatest&tlsVerify=false&variant=v8",
+		api.Requests(),
+	)
+	auth, err := base64.URLEncoding.DecodeString(api.pullHeader.Get("X-Registry-Auth"))
+	assert.NoError(t, err)
+	assert.Equals(t, string(auth), `{"quay.io":{"username":"robot","password":"hunter2"}}`)
+
+	api.pullError = "reading manifest latest in quay.io/arcalot/echo: unauthorized"
+	err = podman.PullImage(ctx, "quay.io/arcalot/echo", cliwrapper.PullOptions{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unauthorized")
+
+	err = podman.PullImage(ctx, "quay.io/arcalot/echo", cliwrapper.PullOptions{CertDir: "/etc/containers/certs.d"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "use the CLI backend")
+}
+
+func TestAPI_Containers(t *testing.T) {
+	_, apiURL := startFakeAPI(t)
+	podman := newAPIWrapper(t, apiURL, log.NewTestLogger(t))
+	ctx := context.Background()
+
+	_, err := podman.Deploy(ctx, "quay.io/arcalot/echo", "running_container", []string{"run", "-i"}, nil)
+	assert.NoError(t, err)
+	state, err := podman.InspectContainer(ctx, "running_container")
+	assert.NoError(t, err)
+	assert.Equals(t, state.Running, true)
+	ports, err := podman.Ports(ctx, "running_container")
+	assert.NoError(t, err)
+	assert.Equals(t, ports, nat.PortMap{"8080/tcp": {{HostIP: "0.0.0.0", HostPort: "18080"}}})
+
+	forceKilled, err := podman.Stop(ctx, "running_container", "SIGTERM", 10*time.Second)
+	assert.NoError(t, err)
+	assert.Equals(t, forceKilled, false)
+	state, err = podman.InspectContainer(ctx, "running_container")
+	assert.NoError(t, err)
+	assert.Equals(t, state.Status, "exited")
+
+	assert.NoError(t, podman.Clean(ctx, "running_container"))
+	_, err = podman.InspectContainer(ctx, "running_container")
+	assert.Equals(t, errors.Is(err, cliwrapper.ErrNoSuchContainer), true)
+	// Removing a missing container is not an error, like with podman rm --force.
+	assert.NoError(t, podman.Clean(ctx, "running_container"))
+}
+
+func TestAPI_Secrets(t *testing.T) {
+	api, apiURL := startFakeAPI(t)
+	podman := newAPIWrapper(t, apiURL, log.NewTestLogger(t))
+	ctx := context.Background()
+
+	assert.NoError(t, podman.CreateSecret(ctx, "plugin_token", []byte("s3cr3t")))
+	assert.Equals(t, api.secrets["plugin_token"], "s3cr3t")
+	assert.NoError(t, podman.RemoveSecret(ctx, "plugin_token"))
+	assert.Equals(t, len(api.secrets), 0)
+
+	err := podman.CreateSecret(ctx, "plugin_token", []byte("invalid-s3cr3t"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "status 500")
+	assert.Equals(t, strings.Contains(err.Error(), "invalid-s3cr3t"), false)
+}
+
+func TestAPI_SecretCreateTimeout(t *testing.T) {
+	_, apiURL := startFakeAPI(t)
+	podman, err := cliwrapper.NewAPIWrapper(
+		apiURL,
+		log.NewTestLogger(t),
+		cliwrapper.Timeouts{SecretCreate: 100 * time.Millisecond},
+		nil,
+	)
+	assert.NoError(t, err)
+
+	err = podman.CreateSecret(context.Background(), "plugin_token", []byte("slow-s3cr3t"))
+	var timeoutErr *cliwrapper.TimeoutError
+	assert.Equals(t, errors.As(err, &timeoutErr), true)
+	assert.Equals(t, timeoutErr.Subcommand, "secret")
+	assert.Equals(t, strings.Contains(err.Error(), "slow-s3cr3t"), false)
+}
+
+func TestAPI_VersionInfo(t *testing.T) {
+	_, apiURL := startFakeAPI(t)
+	podman := newAPIWrapper(t, apiURL, log.NewTestLogger(t))
+
+	version := assert.NoErrorR[*cliwrapper.VersionInfo](t)(podman.Version(context.Background()))
+	assert.Equals(t, *version, cliwrapper.VersionInfo{Server: "5.0.2"})
+	info := assert.NoErrorR[*cliwrapper.HostInfo](t)(podman.Info(context.Background()))
+	assert.Equals(t, *info, cliwrapper.HostInfo{
+		Version:        "4.9.3",
+		Rootless:       true,
+		CgroupVersion:  "v2",
+		OCIRuntime:     "crun",
+		NetworkBackend: "netavark",
+	})
+}
+
+func TestParseAPIURL(t *testing.T) {
+	network, address, err := cliwrapper.ParseAPIURL("unix:///run/podman/podman.sock")
+	assert.NoError(t, err)
+	assert.Equals(t, network, "unix")
+	assert.Equals(t, address, "/run/podman/podman.sock")
+	network, address, err = cliwrapper.ParseAPIURL("tcp://localhost:8080")
+	assert.NoError(t, err)
+	assert.Equals(t, network, "tcp")
+	assert.Equals(t, address, "localhost:8080")
+
+	_, _, err = cliwrapper.ParseAPIURL("ssh://core@engine.lab/run/podman/podman.sock")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "SSH tunnel")
+	_, _, err = cliwrapper.ParseAPIURL("http://localhost:8080")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "must have the unix:// or tcp:// scheme")
+}
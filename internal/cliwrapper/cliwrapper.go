@@ -2,37 +2,92 @@ package cliwrapper
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/docker/go-connections/nat"
 	log "go.arcalot.io/log/v2"
 	"go.flow.arcalot.io/podmandeployer/internal/util"
 )
 
+// processWaitDelay bounds how long a cancelled podman process may keep its
+// output pipes open before they are forcibly closed.
+const processWaitDelay = 5 * time.Second
+
+// containerStartPollInterval is the interval between checks of the container
+// state while waiting for a deployed container to start.
+const containerStartPollInterval = 250 * time.Millisecond
+
+// containerStopPollInterval is the interval between checks of the container
+// state while waiting for a signalled container to exit.
+const containerStopPollInterval = 250 * time.Millisecond
+
 type cliWrapper struct {
 	podmanFullPath string
 	logger         log.Logger
-	connectionName []string
+	connectionArgs []string
+	timeouts       Timeouts
+	redactor       redactor
 }
 
-func NewCliWrapper(fullPath string, logger log.Logger, connectionName *string) CliWrapper {
-	// Specify podman --connection string if provided
-	connection := []string{}
-	if connectionName != nil {
-		connection = append(connection, "--connection="+*connectionName)
+// Connection selects the podman service the CLI talks to. The zero value uses
+// the default connection of podman.
+type Connection struct {
+	// Name is a connection added with podman system connection add.
+	Name string
+	// URL is the unix://, tcp:// or ssh:// URL of the podman service.
+	URL string
+	// Identity is the path of the SSH identity file for ssh:// URLs.
+	Identity string
+}
+
+// args returns the global podman flags selecting the connection.
+func (c Connection) args() []string {
+	var args []string
+	if c.Name != "" {
+		args = append(args, "--connection="+c.Name)
+	}
+	if c.URL != "" {
+		args = append(args, "--url="+c.URL)
+	}
+	if c.Identity != "" {
+		args = append(args, "--identity="+c.Identity)
 	}
+	return args
+}
 
+// NewCliWrapper creates a wrapper around the podman CLI, talking to the podman service of the connection. The matches
+// of the sensitive patterns are masked in the logged command lines and in the podman output embedded in errors, in
+// addition to environment variable values and registry credentials.
+func NewCliWrapper(
+	fullPath string,
+	logger log.Logger,
+	connection Connection,
+	timeouts Timeouts,
+	sensitivePatterns []*regexp.Regexp,
+) CliWrapper {
 	return &cliWrapper{
 		podmanFullPath: fullPath,
 		logger:         logger,
-		connectionName: connection,
+		connectionArgs: connection.args(),
+		timeouts:       timeouts,
+		redactor:       redactor{patterns: sensitivePatterns},
 	}
 }
 
-func (p *cliWrapper) decorateImageName(image string) string {
+// decorateImageName adds the latest tag to images without a tag.
+func decorateImageName(image string) string {
 	imageParts := strings.Split(image, ":")
 	if len(imageParts) == 1 {
 		image = fmt.Sprintf("%s:latest", image)
@@ -40,8 +95,43 @@ func (p *cliWrapper) decorateImageName(image string) string {
 	return image
 }
 
-func (p *cliWrapper) ImageExists(image string) (*bool, error) {
+func (p *cliWrapper) Version(ctx context.Context) (*VersionInfo, error) {
+	outStr, err := p.runPodmanCmdWithTimeout(
+		ctx,
+		p.timeouts.Probe,
+		"getting the podman version",
+		"version", "--format", "json",
+	)
+	if err != nil {
+		return nil, err
+	}
+	var output versionOutput
+	if err := json.Unmarshal([]byte(outStr), &output); err != nil {
+		return nil, fmt.Errorf("failed to decode the podman version (%w)", err)
+	}
+	return output.versionInfo(), nil
+}
+
+func (p *cliWrapper) Info(ctx context.Context) (*HostInfo, error) {
+	outStr, err := p.runPodmanCmdWithTimeout(
+		ctx,
+		p.timeouts.Probe,
+		"getting the podman host information",
+		"info", "--format", "json",
+	)
+	if err != nil {
+		return nil, err
+	}
+	var output infoOutput
+	if err := json.Unmarshal([]byte(outStr), &output); err != nil {
+		return nil, fmt.Errorf("failed to decode the podman host information (%w)", err)
+	}
+	return output.hostInfo(), nil
+}
+
+func (p *cliWrapper) ImageExists(ctx context.Context, image string) (*bool, error) {
 	outStr, err := p.runPodmanCmd(
+		ctx,
 		"checking whether image exists",
 		"image", "ls", "--format", "{{.Repository}}:{{.Tag}}",
 	)
@@ -49,92 +139,463 @@ func (p *cliWrapper) ImageExists(image string) (*bool, error) {
 		return nil, err
 	}
 	outSlice := strings.Split(outStr, "\n")
-	exists := util.SliceContains(outSlice, p.decorateImageName(image))
+	exists := util.SliceContains(outSlice, decorateImageName(image))
 	return &exists, nil
 }
 
-func (p *cliWrapper) ContainerRunning(containerID string) (bool, error) {
+func (p *cliWrapper) ImageDigest(ctx context.Context, image string) (string, error) {
 	outStr, err := p.runPodmanCmd(
-		"checking whether container is running",
-		"container", "ls", "--format", "{{.Names}}",
+		ctx,
+		"inspecting image digest",
+		"image", "inspect", "--format", "{{.Digest}}", decorateImageName(image),
 	)
 	if err != nil {
-		return true, err
+		return "", err
 	}
-	outSlice := strings.Split(outStr, "\n")
-	exists := util.SliceContains(outSlice, containerID)
-	return exists, nil
+	return strings.TrimSpace(outStr), nil
+}
+
+func (p *cliWrapper) ImageRepoDigests(ctx context.Context, image string) ([]string, error) {
+	outStr, err := p.runPodmanCmd(
+		ctx,
+		"inspecting image repository digests",
+		"image", "inspect", "--format", "{{range .RepoDigests}}{{println .}}{{end}}", decorateImageName(image),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(outStr), nil
+}
+
+func (p *cliWrapper) InspectContainer(ctx context.Context, containerNameOrID string) (*ContainerState, error) {
+	outStr, err := p.runPodmanCmd(
+		ctx,
+		"inspecting container "+containerNameOrID,
+		"container", "inspect", "--format", "{{json .State}}", containerNameOrID,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such container") {
+			return nil, fmt.Errorf("%w: %s", ErrNoSuchContainer, containerNameOrID)
+		}
+		return nil, err
+	}
+	var state ContainerState
+	if err := json.Unmarshal([]byte(outStr), &state); err != nil {
+		return nil, fmt.Errorf("failed to decode the state of container %s (%w)", containerNameOrID, err)
+	}
+	return &state, nil
 }
 
-func (p *cliWrapper) PullImage(image string, platform *string) error {
+func (p *cliWrapper) Ports(ctx context.Context, containerNameOrID string) (nat.PortMap, error) {
+	outStr, err := p.runPodmanCmd(ctx, "listing the ports of container "+containerNameOrID, "port", containerNameOrID)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such container") {
+			return nil, fmt.Errorf("%w: %s", ErrNoSuchContainer, containerNameOrID)
+		}
+		return nil, err
+	}
+	ports := nat.PortMap{}
+	// Each line has the format 80/tcp -> 0.0.0.0:8080, with IPv6 addresses in brackets.
+	for _, line := range strings.Split(outStr, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		containerPort, hostAddress, found := strings.Cut(line, " -> ")
+		if !found {
+			return nil, fmt.Errorf("unexpected port mapping %q of container %s", line, containerNameOrID)
+		}
+		hostIP, hostPort, err := net.SplitHostPort(strings.TrimSpace(hostAddress))
+		if err != nil {
+			return nil, fmt.Errorf("unexpected port mapping %q of container %s (%w)", line, containerNameOrID, err)
+		}
+		port := nat.Port(strings.TrimSpace(containerPort))
+		ports[port] = append(ports[port], nat.PortBinding{HostIP: hostIP, HostPort: hostPort})
+	}
+	return ports, nil
+}
+
+func (p *cliWrapper) PullImage(ctx context.Context, image string, options PullOptions) error {
 	commandArgs := []string{"pull"}
-	if platform != nil {
-		commandArgs = append(commandArgs, "--platform", *platform)
+	if options.Platform != nil {
+		commandArgs = append(commandArgs, "--platform", *options.Platform)
+	}
+	if options.AuthFile != "" {
+		commandArgs = append(commandArgs, "--authfile", options.AuthFile)
+	}
+	if options.TLSVerify != nil {
+		commandArgs = append(commandArgs, "--tls-verify="+strconv.FormatBool(*options.TLSVerify))
+	}
+	if options.CertDir != "" {
+		commandArgs = append(commandArgs, "--cert-dir", options.CertDir)
+	}
+	if options.SignaturePolicy != "" {
+		commandArgs = append(commandArgs, "--signature-policy", options.SignaturePolicy)
 	}
-	commandArgs = append(commandArgs, p.decorateImageName(image))
-	_, err := p.runPodmanCmd("pulling image", commandArgs...)
+	commandArgs = append(commandArgs, decorateImageName(image))
+	_, err := p.runPodmanCmdWithTimeout(ctx, p.timeouts.ImagePull, "pulling image", commandArgs...)
 	return err
 }
 
-func (p *cliWrapper) Deploy(image string, podmanArgs []string, containerArgs []string) (io.WriteCloser, io.ReadCloser, error) {
-	podmanArgs = append(podmanArgs, p.decorateImageName(image))
+func (p *cliWrapper) Deploy(
+	ctx context.Context,
+	image string,
+	containerName string,
+	podmanArgs []string,
+	containerArgs []string,
+) (Process, error) {
+	podmanArgs = append(podmanArgs, decorateImageName(image))
 	podmanArgs = append(podmanArgs, containerArgs...)
-	deployCommand := p.getPodmanCmd(podmanArgs...)
-	p.logger.Debugf("Deploying with command %v", deployCommand.Args)
+	deployCommand := p.getPodmanCmd(ctx, podmanArgs...)
+	deployCommand.Cancel = func() error {
+		p.logger.Infof("context done (%s); killing podman process for container %s", ctx.Err(), containerName)
+		return p.stopDeployment(deployCommand, containerName)
+	}
+	redactedArgs, secrets := p.redactor.redactArgs(deployCommand.Args)
+	p.logger.Debugf("Deploying with command %v", redactedArgs)
 	stdin, err := deployCommand.StdinPipe()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	// Use plain pipes rather than StdoutPipe() and StderrPipe(), so that
+	// reaping the process does not close them before the output is read.
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
 	}
-	stdout, err := deployCommand.StdoutPipe()
+	stderr, stderrWriter, err := os.Pipe()
 	if err != nil {
-		return nil, nil, err
+		_ = stdout.Close()
+		_ = stdoutWriter.Close()
+		return nil, err
 	}
-	if err := deployCommand.Start(); err != nil {
-		return nil, nil, errors.New(err.Error())
+	deployCommand.Stdout = stdoutWriter
+	deployCommand.Stderr = stderrWriter
+	startErr := deployCommand.Start()
+	// The podman process holds its own copies of the write ends.
+	_ = stdoutWriter.Close()
+	_ = stderrWriter.Close()
+	if startErr != nil {
+		_ = stdout.Close()
+		_ = stderr.Close()
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("deployment of container %s cancelled (%w)", containerName, ctx.Err())
+		}
+		return nil, errors.New(startErr.Error())
 	}
-	return stdin, stdout, nil
+
+	process := &podmanProcess{
+		stdin:      stdin,
+		stderr:     newRingBuffer(stderrTailLines),
+		stderrDone: make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go process.captureStderr(stderr, p.logger.WithLabel("container", containerName), func(line string) string {
+		return p.redactor.redactText(line, secrets)
+	})
+	go p.reap(deployCommand, containerName, process)
+
+	if err := p.waitForContainerStart(ctx, containerName, process.done); err != nil {
+		if killErr := p.stopDeployment(deployCommand, containerName); killErr != nil {
+			p.logger.Debugf("failed to kill podman process for container %s (%s)", containerName, killErr.Error())
+		}
+		_ = stdin.Close()
+		_ = stdout.Close()
+		select {
+		case <-process.stderrDone:
+		case <-time.After(stderrDrainTimeout):
+		}
+		if stderrTail := process.Stderr(); stderrTail != "" {
+			return nil, fmt.Errorf("%w; stderr:\n%s", err, stderrTail)
+		}
+		return nil, err
+	}
+	process.stdout = &stdoutReader{
+		ReadCloser: newHandshakeReader(stdout, p.timeouts.ATPHandshake, func() {
+			p.logger.Errorf("no output from container %s within %s; killing it", containerName, p.timeouts.ATPHandshake)
+			if err := p.stopDeployment(deployCommand, containerName); err != nil {
+				p.logger.Debugf("failed to kill podman process for container %s (%s)", containerName, err.Error())
+			}
+		}),
+		stderrDone: process.stderrDone,
+	}
+	return process, nil
+}
+
+// reap waits for the podman run process to exit and records the exit status
+// of the container on the process.
+func (p *cliWrapper) reap(deployCommand *exec.Cmd, containerName string, process *podmanProcess) {
+	defer close(process.done)
+	if err := deployCommand.Wait(); err != nil {
+		p.logger.Debugf("podman process for container %s exited (%s)", containerName, err.Error())
+	}
+	status := newExitStatus(deployCommand.ProcessState)
+	if !status.Success() {
+		// The container is only removed explicitly, so its state is still available.
+		ctx, cancel := withTimeout(context.Background(), p.timeouts.Kill)
+		defer cancel()
+		if state, err := p.InspectContainer(ctx, containerName); err == nil {
+			status.OOMKilled = state.OOMKilled
+		}
+	}
+	p.logger.Debugf("container %s %s", containerName, status)
+	process.exitStatus = status
 }
 
-func (p *cliWrapper) Kill(containerName string) error {
-	_, err := p.runPodmanCmd("killing container "+containerName, "kill", containerName)
+// waitForContainerStart polls the container state until the container has
+// started, the podman process exits, the context is done, or the container
+// start timeout expires.
+func (p *cliWrapper) waitForContainerStart(ctx context.Context, containerName string, exited <-chan struct{}) error {
+	startCtx, cancel := withTimeout(ctx, p.timeouts.ContainerStart)
+	defer cancel()
+	ticker := time.NewTicker(containerStartPollInterval)
+	defer ticker.Stop()
+	for {
+		started, err := p.containerStarted(startCtx, containerName)
+		if started {
+			return nil
+		}
+		select {
+		case <-exited:
+			// The container may have started and exited between two polls.
+			if started, _ := p.containerStarted(ctx, containerName); started {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("podman run exited before container %s started (%w)", containerName, err)
+			}
+			return fmt.Errorf("podman run exited before container %s started", containerName)
+		case <-startCtx.Done():
+			if ctx.Err() != nil {
+				return fmt.Errorf("waiting for container %s to start cancelled (%w)", containerName, ctx.Err())
+			}
+			return &TimeoutError{
+				Subcommand: "run",
+				WaitingFor: "container " + containerName + " to start",
+				Timeout:    p.timeouts.ContainerStart,
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// containerStarted reports whether the container exists and has left the
+// created state; a container which already exited counts as started.
+func (p *cliWrapper) containerStarted(ctx context.Context, containerName string) (bool, error) {
+	state, err := p.InspectContainer(ctx, containerName)
 	if err != nil {
+		return false, err
+	}
+	return state.Started(), nil
+}
+
+// stopDeployment kills the attached podman process and removes the container,
+// which the podman process leaves behind when it is killed.
+func (p *cliWrapper) stopDeployment(deployCommand *exec.Cmd, containerName string) error {
+	killErr := deployCommand.Process.Kill()
+	if err := p.Clean(context.Background(), containerName); err != nil {
+		p.logger.Warningf("failed to remove container %s (%s)", containerName, err.Error())
+	}
+	if errors.Is(killErr, os.ErrProcessDone) {
+		return nil
+	}
+	return killErr
+}
+
+func (p *cliWrapper) Kill(ctx context.Context, containerName string) error {
+	_, err := p.runPodmanCmdWithTimeout(ctx, p.timeouts.Kill, "killing container "+containerName, "kill", containerName)
+	var timeoutErr *TimeoutError
+	switch {
+	case errors.As(err, &timeoutErr):
+		return err
+	case err != nil:
 		p.logger.Warningf("failed to kill pod %s (%s); it may have exited earlier", containerName, err.Error())
-	} else {
+	default:
 		p.logger.Debugf("successfully killed container %s", containerName)
 	}
 	return nil
 }
 
-func (p *cliWrapper) Clean(containerName string) error {
+func (p *cliWrapper) Stop(ctx context.Context, containerName string, signal string, timeout time.Duration) (bool, error) {
+	if _, err := p.runPodmanCmdWithTimeout(
+		ctx,
+		p.timeouts.Kill,
+		"sending "+signal+" to container "+containerName,
+		"kill", "--signal", signal, containerName,
+	); err != nil {
+		var timeoutErr *TimeoutError
+		if errors.As(err, &timeoutErr) {
+			return false, err
+		}
+		// The container most likely exited in the meantime, which the
+		// state check below confirms.
+		p.logger.Debugf("failed to send %s to container %s (%s)", signal, containerName, err.Error())
+	}
+	return waitForStop(ctx, p, containerName, timeout)
+}
+
+// waitForStop polls the state of the signalled container until it exits,
+// killing it if it is still running after the timeout. Reports whether the
+// container had to be killed.
+func waitForStop(ctx context.Context, wrapper CliWrapper, containerName string, timeout time.Duration) (bool, error) {
+	// Unlike the other timeouts, a zero timeout does not wait at all.
+	stopCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(containerStopPollInterval)
+	defer ticker.Stop()
+	for {
+		state, err := wrapper.InspectContainer(stopCtx, containerName)
+		if errors.Is(err, ErrNoSuchContainer) || (err == nil && !state.Running) {
+			return false, nil
+		}
+		select {
+		case <-stopCtx.Done():
+			if ctx.Err() != nil {
+				return false, fmt.Errorf("stopping container %s cancelled (%w)", containerName, ctx.Err())
+			}
+			return true, wrapper.Kill(ctx, containerName)
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *cliWrapper) Clean(ctx context.Context, containerName string) error {
 	msg := "removing container " + containerName
-	_, err := p.runPodmanCmd(msg, "rm", "--force", containerName)
-	if err != nil {
+	_, err := p.runPodmanCmdWithTimeout(ctx, p.timeouts.Remove, msg, "rm", "--force", containerName)
+	var timeoutErr *TimeoutError
+	switch {
+	case errors.As(err, &timeoutErr):
+		return err
+	case err != nil:
 		p.logger.Errorf(err.Error())
-	} else {
+	default:
 		p.logger.Debugf("successfully removed container %s", containerName)
 	}
 	return nil
 }
 
-func (p *cliWrapper) getPodmanCmd(cmdArgs ...string) *exec.Cmd {
-	commandArgs := make([]string, 0, len(p.connectionName)+len(cmdArgs))
-	commandArgs = append(commandArgs, p.connectionName...)
+func (p *cliWrapper) CreateSecret(ctx context.Context, name string, value []byte) error {
+	_, err := p.runPodmanCmdWithInputAndTimeout(
+		ctx,
+		p.timeouts.SecretCreate,
+		value,
+		"creating secret "+name,
+		"secret", "create", name, "-",
+	)
+	return err
+}
+
+func (p *cliWrapper) RemoveSecret(ctx context.Context, name string) error {
+	_, err := p.runPodmanCmdWithTimeout(ctx, p.timeouts.Remove, "removing secret "+name, "secret", "rm", name)
+	return err
+}
+
+func (p *cliWrapper) getPodmanCmd(ctx context.Context, cmdArgs ...string) *exec.Cmd {
+	commandArgs := make([]string, 0, len(p.connectionArgs)+len(cmdArgs))
+	commandArgs = append(commandArgs, p.connectionArgs...)
 	commandArgs = append(commandArgs, cmdArgs...)
-	return exec.Command(p.podmanFullPath, commandArgs...) //#nosec G204 -- command line is internally generated
+	cmd := exec.CommandContext(ctx, p.podmanFullPath, commandArgs...) //#nosec G204 -- command line is internally generated
+	cmd.WaitDelay = processWaitDelay
+	return cmd
 }
 
-func (p *cliWrapper) runPodmanCmd(msg string, cmdArgs ...string) (string, error) {
+func (p *cliWrapper) runPodmanCmd(ctx context.Context, msg string, cmdArgs ...string) (string, error) {
+	return p.runPodmanCmdWithInput(ctx, nil, msg, cmdArgs...)
+}
+
+// runPodmanCmdWithInput runs the podman command like runPodmanCmd, passing the
+// input to it through stdin. The input is treated as a secret and masked in the
+// returned errors.
+func (p *cliWrapper) runPodmanCmdWithInput(ctx context.Context, input []byte, msg string, cmdArgs ...string) (string, error) {
 	var out bytes.Buffer
 	var errOut bytes.Buffer
 
-	cmd := p.getPodmanCmd(cmdArgs...)
+	cmd := p.getPodmanCmd(ctx, cmdArgs...)
 	cmd.Stdout = &out
 	cmd.Stderr = &errOut
-	p.logger.Debugf(msg+" with command %v", cmd.Args)
+	redactedArgs, secrets := p.redactor.redactArgs(cmd.Args)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+		secrets = append(secrets, string(input))
+	}
+	p.logger.Debugf(msg+" with command %v", redactedArgs)
 	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("%s cancelled (%w)", msg, ctx.Err())
+		}
 		return "", fmt.Errorf(
 			"error while %s. Stdout: '%s', Stderr: '%s', Cmd error: (%w)",
-			msg, strings.TrimSpace(out.String()), strings.TrimSpace(errOut.String()), err)
+			msg,
+			p.redactor.redactText(strings.TrimSpace(out.String()), secrets),
+			p.redactor.redactText(strings.TrimSpace(errOut.String()), secrets),
+			err,
+		)
 	}
 	return out.String(), nil
 }
+
+// runPodmanCmdWithTimeout runs the podman command like runPodmanCmd, but
+// returns a TimeoutError naming the subcommand if it does not finish within
+// the timeout.
+func (p *cliWrapper) runPodmanCmdWithTimeout(
+	ctx context.Context,
+	timeout time.Duration,
+	msg string,
+	cmdArgs ...string,
+) (string, error) {
+	return p.runPodmanCmdWithInputAndTimeout(ctx, timeout, nil, msg, cmdArgs...)
+}
+
+// runPodmanCmdWithInputAndTimeout runs the podman command with the input on
+// stdin, returning a TimeoutError if it does not finish within the timeout.
+func (p *cliWrapper) runPodmanCmdWithInputAndTimeout(
+	ctx context.Context,
+	timeout time.Duration,
+	input []byte,
+	msg string,
+	cmdArgs ...string,
+) (string, error) {
+	cmdCtx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	out, err := p.runPodmanCmdWithInput(cmdCtx, input, msg, cmdArgs...)
+	if err != nil && ctx.Err() == nil && errors.Is(cmdCtx.Err(), context.DeadlineExceeded) {
+		return "", &TimeoutError{Subcommand: cmdArgs[0], Timeout: timeout}
+	}
+	return out, err
+}
+
+// handshakeReader kills the deployment if the plugin does not produce any
+// output within the ATP handshake timeout.
+type handshakeReader struct {
+	io.ReadCloser
+	timeout  time.Duration
+	timer    *time.Timer
+	timedOut atomic.Bool
+}
+
+func newHandshakeReader(stdout io.ReadCloser, timeout time.Duration, onTimeout func()) io.ReadCloser {
+	if timeout == 0 {
+		return stdout
+	}
+	r := &handshakeReader{ReadCloser: stdout, timeout: timeout}
+	r.timer = time.AfterFunc(timeout, func() {
+		r.timedOut.Store(true)
+		onTimeout()
+	})
+	return r
+}
+
+func (r *handshakeReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	if n > 0 {
+		r.timer.Stop()
+	}
+	if err != nil && r.timedOut.Load() {
+		return n, &TimeoutError{Subcommand: "run", WaitingFor: "the ATP handshake", Timeout: r.timeout}
+	}
+	return n, err
+}
+
+func (r *handshakeReader) Close() error {
+	r.timer.Stop()
+	return r.ReadCloser.Close()
+}
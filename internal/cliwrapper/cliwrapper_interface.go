@@ -1,18 +1,57 @@
 package cliwrapper
 
 import (
-	"io"
+	"context"
+	"time"
+
+	"github.com/docker/go-connections/nat"
 )
 
+// PullOptions are the options of an image pull.
+type PullOptions struct {
+	// Platform is the platform of the image to pull, e.g. linux/arm64.
+	Platform *string
+	// AuthFile is the path of the authentication file with the registry credentials.
+	AuthFile string
+	// TLSVerify drives whether the registry's certificate is verified. Unset keeps the podman default.
+	TLSVerify *bool
+	// CertDir is the directory of the certificates for the registry.
+	CertDir string
+	// SignaturePolicy is the path of the containers-policy.json file the
+	// signatures of the image are verified against.
+	SignaturePolicy string
+}
+
 type CliWrapper interface {
-	ImageExists(image string) (*bool, error)
-	ContainerRunning(image string) (bool, error)
-	PullImage(image string, platform *string) error
+	// Version returns the version of the podman client and service.
+	Version(ctx context.Context) (*VersionInfo, error)
+	// Info describes the host of the podman service.
+	Info(ctx context.Context) (*HostInfo, error)
+	ImageExists(ctx context.Context, image string) (*bool, error)
+	ImageDigest(ctx context.Context, image string) (string, error)
+	// ImageRepoDigests returns the repository digests of the local image in the
+	// repository@digest format, including the digest of the manifest list for
+	// multi-platform images.
+	ImageRepoDigests(ctx context.Context, image string) ([]string, error)
+	InspectContainer(ctx context.Context, containerNameOrID string) (*ContainerState, error)
+	// Ports returns the host ports the published ports of the container are bound to.
+	Ports(ctx context.Context, containerNameOrID string) (nat.PortMap, error)
+	PullImage(ctx context.Context, image string, options PullOptions) error
 	Deploy(
+		ctx context.Context,
 		image string,
+		containerName string,
 		podmanArgs []string,
 		containerArgs []string,
-	) (io.WriteCloser, io.ReadCloser, error)
-	Kill(containerName string) error
-	Clean(containerName string) error
+	) (Process, error)
+	Kill(ctx context.Context, containerName string) error
+	// Stop sends the signal to the container and waits up to the timeout for
+	// it to exit, killing it afterwards like podman stop --time does. Reports
+	// whether the container had to be killed.
+	Stop(ctx context.Context, containerName string, signal string, timeout time.Duration) (bool, error)
+	Clean(ctx context.Context, containerName string) error
+	// CreateSecret creates a podman secret, passing the value to podman through
+	// stdin so that it does not show up in the process list.
+	CreateSecret(ctx context.Context, name string, value []byte) error
+	RemoveSecret(ctx context.Context, name string) error
 }
@@ -0,0 +1,30 @@
+package cliwrapper
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoSuchContainer indicates that podman does not know the container.
+var ErrNoSuchContainer = errors.New("no such container")
+
+// ContainerState is the state of a container as reported by podman container inspect.
+type ContainerState struct {
+	// Status is the podman status of the container, e.g. "running" or "exited".
+	Status     string    `json:"Status"`
+	Running    bool      `json:"Running"`
+	ExitCode   int       `json:"ExitCode"`
+	OOMKilled  bool      `json:"OOMKilled"`
+	StartedAt  time.Time `json:"StartedAt"`
+	FinishedAt time.Time `json:"FinishedAt"`
+}
+
+// Started reports whether the container has left the created state; a
+// container which already exited counts as started.
+func (s ContainerState) Started() bool {
+	switch s.Status {
+	case "running", "paused", "stopping", "stopped", "exited":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package cliwrapper
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "go.arcalot.io/log/v2"
+)
+
+// stderrTailLines is the number of most recent stderr lines retained for
+// error reporting.
+const stderrTailLines = 50
+
+// maxStderrLineLength bounds the length of a single retained stderr line.
+const maxStderrLineLength = 4096
+
+// stderrDrainTimeout bounds how long reaching the end of stdout waits for the
+// remaining stderr output to be captured.
+const stderrDrainTimeout = time.Second
+
+// Process is a plugin container deployed through an attached podman process.
+type Process interface {
+	// Stdin returns the standard input of the plugin.
+	Stdin() io.WriteCloser
+	// Stdout returns the standard output of the plugin.
+	Stdout() io.ReadCloser
+	// Stderr returns the most recent lines the container wrote to its standard
+	// error, oldest first.
+	Stderr() string
+	// Done returns a channel which is closed once the podman process has
+	// exited and has been reaped.
+	Done() <-chan struct{}
+	// ExitStatus returns how the container terminated, or nil if the podman
+	// process has not exited yet.
+	ExitStatus() *ExitStatus
+}
+
+// ExitStatus describes how a deployed plugin container terminated.
+type ExitStatus struct {
+	// ExitCode is the exit code reported by podman run, or -1 if the podman
+	// process itself was terminated by a signal or the exit code is unknown.
+	ExitCode int
+	// Signal is the signal which terminated the container or the podman
+	// process, if any.
+	Signal syscall.Signal
+	// OOMKilled is set if the container was killed for running out of memory.
+	OOMKilled bool
+}
+
+// Success reports whether the container exited on its own with exit code 0.
+func (s ExitStatus) Success() bool {
+	return s.ExitCode == 0 && !s.OOMKilled
+}
+
+// String describes the termination reason, e.g. "exited with code 1".
+func (s ExitStatus) String() string {
+	switch {
+	case s.OOMKilled:
+		return fmt.Sprintf("was killed because it ran out of memory (OOM, exit code %d)", s.ExitCode)
+	case s.Signal != 0:
+		return fmt.Sprintf("was terminated by signal %d (%s)", int(s.Signal), s.Signal.String())
+	case s.ExitCode == 125:
+		return "could not be run by podman (exit code 125)"
+	case s.ExitCode == 126:
+		return "has a command which could not be invoked (exit code 126)"
+	case s.ExitCode == 127:
+		return "has a command which could not be found (exit code 127)"
+	}
+	return fmt.Sprintf("exited with code %d", s.ExitCode)
+}
+
+// newExitStatus derives the exit status from the state of the reaped podman
+// run process. Following the shell convention, podman reports a container
+// terminated by a signal with an exit code of 128 plus the signal number.
+func newExitStatus(state *os.ProcessState) *ExitStatus {
+	if waitStatus, ok := state.Sys().(syscall.WaitStatus); ok && waitStatus.Signaled() {
+		return &ExitStatus{ExitCode: state.ExitCode(), Signal: waitStatus.Signal()}
+	}
+	return exitStatusFromCode(state.ExitCode())
+}
+
+// exitStatusFromCode derives the exit status from the exit code of a container,
+// which is 128 plus the signal number if a signal terminated it.
+func exitStatusFromCode(exitCode int) *ExitStatus {
+	status := &ExitStatus{ExitCode: exitCode}
+	if exitCode > 128 && exitCode < 160 {
+		status.Signal = syscall.Signal(exitCode - 128)
+	}
+	return status
+}
+
+type podmanProcess struct {
+	stdin      io.WriteCloser
+	stdout     io.ReadCloser
+	stderr     *ringBuffer
+	stderrDone chan struct{}
+	done       chan struct{}
+	// Written before done is closed.
+	exitStatus *ExitStatus
+}
+
+func (p *podmanProcess) Stdin() io.WriteCloser {
+	return p.stdin
+}
+
+func (p *podmanProcess) Stdout() io.ReadCloser {
+	return p.stdout
+}
+
+func (p *podmanProcess) Stderr() string {
+	return p.stderr.String()
+}
+
+func (p *podmanProcess) Done() <-chan struct{} {
+	return p.done
+}
+
+func (p *podmanProcess) ExitStatus() *ExitStatus {
+	select {
+	case <-p.done:
+		return p.exitStatus
+	default:
+		return nil
+	}
+}
+
+// captureStderr streams the container's stderr line by line into the logger
+// and the tail buffer until the stream is closed, passing every line through
+// redact first.
+func (p *podmanProcess) captureStderr(stderr io.ReadCloser, logger log.Logger, redact func(string) string) {
+	defer close(p.stderrDone)
+	defer func() { _ = stderr.Close() }()
+	scanner := bufio.NewScanner(stderr)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), 1024*1024)
+	for scanner.Scan() {
+		line := redact(scanner.Text())
+		logger.Infof("%s", line)
+		if len(line) > maxStderrLineLength {
+			line = line[:maxStderrLineLength] + "..."
+		}
+		p.stderr.Add(line)
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Warningf("failed to read container stderr (%s)", err.Error())
+		// Keep draining, so that the container does not block on a full pipe.
+		_, _ = io.Copy(io.Discard, stderr)
+	}
+}
+
+// stdoutReader waits for the remaining stderr output to be captured once the
+// end of stdout is reached, so that it can be reported alongside the EOF.
+type stdoutReader struct {
+	io.ReadCloser
+	stderrDone <-chan struct{}
+}
+
+func (r *stdoutReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	if errors.Is(err, io.EOF) {
+		select {
+		case <-r.stderrDone:
+		case <-time.After(stderrDrainTimeout):
+		}
+	}
+	return n, err
+}
+
+// ringBuffer retains the last lines added to it.
+type ringBuffer struct {
+	lock  sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{lines: make([]string, size)}
+}
+
+func (r *ringBuffer) Add(line string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *ringBuffer) String() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.full {
+		return strings.Join(r.lines[:r.next], "\n")
+	}
+	return strings.Join(append(append([]string{}, r.lines[r.next:]...), r.lines[:r.next]...), "\n")
+}
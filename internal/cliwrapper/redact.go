@@ -0,0 +1,84 @@
+package cliwrapper
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// redactedValue replaces sensitive values in the logs and errors.
+const redactedValue = "***"
+
+// minRedactedSecretLength is the length below which secret values taken from the command line are not masked in the
+// podman output, since masking values like 1 or true would mangle unrelated text.
+const minRedactedSecretLength = 4
+
+// urlCredentialsPattern matches the password of credentials embedded in a URL, e.g. in a proxy or registry URL.
+var urlCredentialsPattern = regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+@`)
+
+// redactor masks secrets in the podman command lines and output which end up in the logs and in returned errors.
+type redactor struct {
+	// patterns are the configured sensitive patterns, whose matches are masked everywhere.
+	patterns []*regexp.Regexp
+}
+
+// redactArgs returns a copy of the podman arguments with the values of environment variables and registry
+// credentials masked, along with the masked values, so that redactText can mask them in the podman output as well.
+func (r redactor) redactArgs(cmdArgs []string) ([]string, []string) {
+	redacted := make([]string, len(cmdArgs))
+	var secrets []string
+	maskValue := func(arg string, separator string) string {
+		prefix, value, found := strings.Cut(arg, separator)
+		if !found {
+			return arg
+		}
+		secrets = append(secrets, value)
+		return prefix + separator + redactedValue
+	}
+	for i := 0; i < len(cmdArgs); i++ {
+		arg := cmdArgs[i]
+		flag, value, hasValue := strings.Cut(arg, "=")
+		switch {
+		case (arg == "-e" || arg == "--env") && i+1 < len(cmdArgs):
+			redacted[i] = arg
+			i++
+			arg = maskValue(cmdArgs[i], "=")
+		case arg == "--creds" && i+1 < len(cmdArgs):
+			redacted[i] = arg
+			i++
+			arg = maskValue(cmdArgs[i], ":")
+		case arg == "--password" && i+1 < len(cmdArgs):
+			redacted[i] = arg
+			i++
+			secrets = append(secrets, cmdArgs[i])
+			arg = redactedValue
+		case hasValue && flag == "--env":
+			arg = flag + "=" + maskValue(value, "=")
+		case hasValue && flag == "--creds":
+			arg = flag + "=" + maskValue(value, ":")
+		case hasValue && flag == "--password":
+			secrets = append(secrets, value)
+			arg = flag + "=" + redactedValue
+		}
+		redacted[i] = r.redactText(arg, nil)
+	}
+	return redacted, secrets
+}
+
+// redactText masks the configured sensitive patterns, the credentials embedded in URLs and the given secrets in the
+// text.
+func (r redactor) redactText(text string, secrets []string) string {
+	// Mask longer secrets first, so that a secret containing another one is masked as a whole.
+	secrets = append([]string{}, secrets...)
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	for _, secret := range secrets {
+		if len(secret) >= minRedactedSecretLength {
+			text = strings.ReplaceAll(text, secret, redactedValue)
+		}
+	}
+	text = urlCredentialsPattern.ReplaceAllString(text, "${1}"+redactedValue+"@")
+	for _, pattern := range r.patterns {
+		text = pattern.ReplaceAllLiteralString(text, redactedValue)
+	}
+	return text
+}
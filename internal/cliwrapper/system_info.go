@@ -0,0 +1,107 @@
+package cliwrapper
+
+// VersionInfo is the podman version as reported by podman version.
+type VersionInfo struct {
+	// Client is the version of the podman CLI; empty for the API.
+	Client string
+	// Server is the version of the podman service; empty for a local podman CLI, which has no separate service.
+	Server string
+}
+
+// versionOutput is the part of the podman version --format json output the wrapper uses.
+type versionOutput struct {
+	Client *struct {
+		Version string `json:"Version"`
+	} `json:"Client"`
+	Server *struct {
+		Version string `json:"Version"`
+	} `json:"Server"`
+}
+
+func (o versionOutput) versionInfo() *VersionInfo {
+	var info VersionInfo
+	if o.Client != nil {
+		info.Client = o.Client.Version
+	}
+	if o.Server != nil {
+		info.Server = o.Server.Version
+	}
+	return &info
+}
+
+// HostInfo describes the host of the podman service as reported by podman info.
+type HostInfo struct {
+	// Version is the version of the podman service.
+	Version  string
+	Rootless bool
+	// CgroupVersion is the cgroup version of the host, "v1" or "v2".
+	CgroupVersion string
+	// OCIRuntime is the name of the OCI runtime running the containers, e.g. "crun".
+	OCIRuntime string
+	// NetworkBackend is the network backend of podman, "netavark" or "cni".
+	NetworkBackend string
+	// SELinuxEnabled is true if SELinux is enabled on the host.
+	SELinuxEnabled bool
+	// UIDMappings and GIDMappings map the IDs of the user namespace of rootless
+	// podman to the IDs of the host.
+	UIDMappings []IDMapping
+	GIDMappings []IDMapping
+	// CgroupControllers are the cgroup controllers podman can use.
+	CgroupControllers []string
+	// StorageDriver is the name of the storage driver, e.g. "overlay".
+	StorageDriver string
+	// StorageStatus is the status of the storage driver, e.g. whether the
+	// backing filesystem supports d_type.
+	StorageStatus map[string]string
+}
+
+// IDMapping maps a range of IDs of a user namespace to IDs of the host.
+type IDMapping struct {
+	ContainerID int `json:"container_id"`
+	HostID      int `json:"host_id"`
+	Size        int `json:"size"`
+}
+
+// infoOutput is the part of the podman info --format json output, and of the
+// libpod info endpoint, the wrapper uses.
+type infoOutput struct {
+	Host struct {
+		CgroupVersion  string `json:"cgroupVersion"`
+		NetworkBackend string `json:"networkBackend"`
+		OCIRuntime     struct {
+			Name string `json:"name"`
+		} `json:"ociRuntime"`
+		Security struct {
+			Rootless       bool `json:"rootless"`
+			SELinuxEnabled bool `json:"selinuxEnabled"`
+		} `json:"security"`
+		IDMappings struct {
+			UIDMap []IDMapping `json:"uidmap"`
+			GIDMap []IDMapping `json:"gidmap"`
+		} `json:"idMappings"`
+		CgroupControllers []string `json:"cgroupControllers"`
+	} `json:"host"`
+	Store struct {
+		GraphDriverName string            `json:"graphDriverName"`
+		GraphStatus     map[string]string `json:"graphStatus"`
+	} `json:"store"`
+	Version struct {
+		Version string `json:"Version"`
+	} `json:"version"`
+}
+
+func (o infoOutput) hostInfo() *HostInfo {
+	return &HostInfo{
+		Version:           o.Version.Version,
+		Rootless:          o.Host.Security.Rootless,
+		CgroupVersion:     o.Host.CgroupVersion,
+		OCIRuntime:        o.Host.OCIRuntime.Name,
+		NetworkBackend:    o.Host.NetworkBackend,
+		SELinuxEnabled:    o.Host.Security.SELinuxEnabled,
+		UIDMappings:       o.Host.IDMappings.UIDMap,
+		GIDMappings:       o.Host.IDMappings.GIDMap,
+		CgroupControllers: o.Host.CgroupControllers,
+		StorageDriver:     o.Store.GraphDriverName,
+		StorageStatus:     o.Store.GraphStatus,
+	}
+}
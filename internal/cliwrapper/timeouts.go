@@ -0,0 +1,50 @@
+package cliwrapper
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Timeouts bound the duration of the podman commands run by the wrapper. A
+// zero value disables the corresponding timeout.
+type Timeouts struct {
+	ImagePull      time.Duration
+	ContainerStart time.Duration
+	ATPHandshake   time.Duration
+	Kill           time.Duration
+	Remove         time.Duration
+	SecretCreate   time.Duration
+	Probe          time.Duration
+}
+
+// TimeoutError indicates that a podman subcommand did not finish, or did not
+// reach the expected state, within its configured timeout. It wraps
+// context.DeadlineExceeded.
+type TimeoutError struct {
+	// Subcommand is the podman subcommand which hung, e.g. "pull".
+	Subcommand string
+	// WaitingFor optionally describes what the subcommand was expected to do.
+	WaitingFor string
+	Timeout    time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	if e.WaitingFor != "" {
+		return fmt.Sprintf("podman %s timed out after %s waiting for %s", e.Subcommand, e.Timeout, e.WaitingFor)
+	}
+	return fmt.Sprintf("podman %s timed out after %s", e.Subcommand, e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// withTimeout derives a context which is done after the timeout, unless the
+// timeout is zero.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
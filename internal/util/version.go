@@ -0,0 +1,49 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a podman version. The zero value is an unknown version.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// ParseVersion parses a version of the major[.minor[.patch]] format, ignoring pre-release and build suffixes such as
+// -rc1 or -dev.
+func ParseVersion(version string) (Version, error) {
+	release, _, _ := strings.Cut(version, "-")
+	release, _, _ = strings.Cut(release, "+")
+	components := strings.Split(release, ".")
+	if len(components) > 3 {
+		return Version{}, fmt.Errorf("invalid version %q", version)
+	}
+	var numbers [3]int
+	for i, component := range components {
+		number, err := strconv.Atoi(component)
+		if err != nil || number < 0 {
+			return Version{}, fmt.Errorf("invalid version %q", version)
+		}
+		numbers[i] = number
+	}
+	return Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}, nil
+}
+
+// Less reports whether the version is older than the other one.
+func (v Version) Less(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
@@ -0,0 +1,126 @@
+package podman
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MountType is the type of mount to add to the plugin container.
+type MountType string
+
+const (
+	// MountTypeBind mounts a file or directory of the host.
+	MountTypeBind MountType = "bind"
+	// MountTypeVolume mounts a named podman volume, creating it if it doesn't exist.
+	MountTypeVolume MountType = "volume"
+	// MountTypeTmpfs mounts an in-memory file system.
+	MountTypeTmpfs MountType = "tmpfs"
+	// MountTypeImage mounts the file system of a container image.
+	MountTypeImage MountType = "image"
+)
+
+// MountRelabel drives the SELinux relabeling of a bind mount.
+type MountRelabel string
+
+const (
+	// MountRelabelShared relabels the source so that all containers can share it, like the z bind option.
+	MountRelabelShared MountRelabel = "shared"
+	// MountRelabelPrivate relabels the source so that only the plugin container can use it, like the Z bind option.
+	MountRelabelPrivate MountRelabel = "private"
+)
+
+// Mount describes a mount of the plugin container.
+type Mount struct {
+	Type MountType `json:"type"`
+	// Source is the host path of a bind mount, the name of a volume or the image of an image mount.
+	Source string `json:"source"`
+	// Target is the absolute path of the mount in the container.
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"readOnly"`
+	// Relabel is the SELinux relabeling of a bind mount. Unset leaves the labels unchanged.
+	Relabel MountRelabel `json:"relabel"`
+	// Propagation is the mount propagation of a bind mount, e.g. rslave.
+	Propagation string `json:"propagation"`
+	// Size is the size limit of a tmpfs mount in bytes.
+	Size int64 `json:"size"`
+}
+
+// hostPathPattern matches absolute Unix paths and Windows paths with a drive letter, which podman machine translates.
+var hostPathPattern = regexp.MustCompile(`^(/|[a-zA-Z]:[\\/])`)
+
+// validate checks the combination of mount options, which the schema cannot express.
+func (m Mount) validate() error {
+	if !strings.HasPrefix(m.Target, "/") {
+		return fmt.Errorf("the target %q of the %s mount must be an absolute path", m.Target, m.Type)
+	}
+	switch {
+	case m.Type == MountTypeTmpfs && m.Source != "":
+		return fmt.Errorf("the tmpfs mount at %s cannot have a source", m.Target)
+	case m.Type != MountTypeTmpfs && m.Source == "":
+		return fmt.Errorf("the %s mount at %s requires a source", m.Type, m.Target)
+	case m.Type == MountTypeBind && !hostPathPattern.MatchString(m.Source):
+		return fmt.Errorf("the source %q of the bind mount at %s must be an absolute path", m.Source, m.Target)
+	case m.Type != MountTypeBind && m.Relabel != "":
+		return fmt.Errorf("the %s mount at %s cannot be relabeled; only bind mounts can", m.Type, m.Target)
+	case m.Type != MountTypeBind && m.Propagation != "":
+		return fmt.Errorf("the %s mount at %s cannot set the propagation; only bind mounts can", m.Type, m.Target)
+	case m.Type != MountTypeTmpfs && m.Size != 0:
+		return fmt.Errorf("the %s mount at %s cannot set a size; only tmpfs mounts can", m.Type, m.Target)
+	}
+	return nil
+}
+
+// spec formats the mount in the comma-separated format of podman run --mount, quoting options containing commas.
+func (m Mount) spec() string {
+	options := []string{"type=" + string(m.Type)}
+	if m.Source != "" {
+		options = append(options, "source="+m.Source)
+	}
+	options = append(options, "target="+m.Target)
+	if m.ReadOnly {
+		options = append(options, "readonly=true")
+	}
+	if m.Relabel != "" {
+		options = append(options, "relabel="+string(m.Relabel))
+	}
+	if m.Propagation != "" {
+		options = append(options, "bind-propagation="+m.Propagation)
+	}
+	if m.Size != 0 {
+		options = append(options, "tmpfs-size="+strconv.FormatInt(m.Size, 10))
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	// Writing to a buffer cannot fail.
+	_ = w.Write(options)
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// validateMounts checks each mount and rejects multiple mounts at the same target.
+func validateMounts(mounts []Mount) error {
+	targets := make(map[string]bool, len(mounts))
+	for _, m := range mounts {
+		if err := m.validate(); err != nil {
+			return err
+		}
+		if targets[m.Target] {
+			return fmt.Errorf("multiple mounts have the target %s", m.Target)
+		}
+		targets[m.Target] = true
+	}
+	return nil
+}
+
+// mountSpecs formats the mounts for podman run --mount.
+func mountSpecs(mounts []Mount) []string {
+	specs := make([]string, len(mounts))
+	for i, m := range mounts {
+		specs[i] = m.spec()
+	}
+	return specs
+}
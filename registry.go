@@ -0,0 +1,127 @@
+package podman
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Registry holds the credentials and TLS options for pulling plugin images from a container registry.
+type Registry struct {
+	// Host is the registry host, optionally with a port and a repository path, e.g. quay.io/arcalot. The most specific
+	// registry matching the image is used.
+	Host     string `json:"host"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Token is an identity token, which the registry exchanges for an access token.
+	Token string `json:"token"`
+	// AuthFile is the path of an existing authentication file on the engine host, in the containers-auth.json format.
+	AuthFile string `json:"authFile"`
+	// TLSVerify drives whether the certificate of the registry is verified. Unset keeps the podman default.
+	TLSVerify *bool `json:"tlsVerify"`
+	// CertDir is the directory on the engine host containing the certificates for the registry.
+	CertDir string `json:"certDir"`
+}
+
+// validate checks the combination of credentials, which the schema cannot express.
+func (r Registry) validate() error {
+	methods := 0
+	for _, set := range []bool{r.Username != "" || r.Password != "", r.Token != "", r.AuthFile != ""} {
+		if set {
+			methods++
+		}
+	}
+	switch {
+	case methods > 1:
+		return fmt.Errorf("the registry %s can only use one of username and password, token or authFile", r.Host)
+	case r.Username != "" && r.Password == "":
+		return fmt.Errorf("the registry %s has a username but no password", r.Host)
+	case r.Username == "" && r.Password != "":
+		return fmt.Errorf("the registry %s has a password but no username", r.Host)
+	}
+	return nil
+}
+
+// matches reports whether the image is pulled from the registry.
+func (r Registry) matches(image string) bool {
+	return image == r.Host || strings.HasPrefix(image, r.Host+"/")
+}
+
+// validateRegistries checks each registry and rejects multiple registries with the same host. The certificate
+// directories are on the engine host, so only a local podman CLI can use them.
+func validateRegistries(registries []Registry, localPodman bool) error {
+	hosts := make(map[string]bool, len(registries))
+	for _, r := range registries {
+		if err := r.validate(); err != nil {
+			return err
+		}
+		if r.CertDir != "" && !localPodman {
+			return fmt.Errorf(
+				"the certDir of registry %s requires a local podman CLI; the %s backend and remote podman services "+
+					"cannot read it on the engine host",
+				r.Host,
+				BackendAPI,
+			)
+		}
+		if hosts[r.Host] {
+			return fmt.Errorf("multiple registries have the host %s", r.Host)
+		}
+		hosts[r.Host] = true
+	}
+	return nil
+}
+
+// matchRegistry returns the most specific registry the image is pulled from, or nil if none matches.
+func matchRegistry(registries []Registry, image string) *Registry {
+	var match *Registry
+	for i, r := range registries {
+		if r.matches(image) && (match == nil || len(r.Host) > len(match.Host)) {
+			match = &registries[i]
+		}
+	}
+	return match
+}
+
+// authFileEntry is the entry of a registry in a containers-auth.json file.
+type authFileEntry struct {
+	Auth          string `json:"auth,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+// writeAuthFile writes the credentials of the registry to a temporary authentication file readable only by the
+// current user, so that they do not show up on the podman command line. The caller must remove the file. Returns an
+// empty path if the registry has no credentials to write.
+func (r Registry) writeAuthFile() (string, error) {
+	var entry authFileEntry
+	switch {
+	case r.Username != "":
+		entry.Auth = base64.StdEncoding.EncodeToString([]byte(r.Username + ":" + r.Password))
+	case r.Token != "":
+		entry.IdentityToken = r.Token
+	default:
+		return "", nil
+	}
+	content, err := json.Marshal(map[string]map[string]authFileEntry{"auths": {r.Host: entry}})
+	if err != nil {
+		return "", err
+	}
+	// CreateTemp creates the file with the 0600 permissions.
+	file, err := os.CreateTemp("", "arcaflow-podman-auth-*.json")
+	if err != nil {
+		return "", fmt.Errorf("failed to create the authentication file of registry %s (%w)", r.Host, err)
+	}
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", errors.Join(
+			fmt.Errorf("failed to write the authentication file of registry %s (%w)", r.Host, err),
+			os.Remove(file.Name()),
+		)
+	}
+	return file.Name(), nil
+}
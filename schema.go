@@ -3,14 +3,27 @@ package podman
 import (
 	"go.flow.arcalot.io/podmandeployer/internal/util"
 
+	"reflect"
 	"regexp"
+	"strings"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/go-connections/nat"
 	"go.flow.arcalot.io/pluginsdk/schema"
 )
 
-const notImplemented = "Not implemented yet in Podman deployer"
+// linuxCapabilities are the names of the Linux capabilities, without the CAP_ prefix.
+var linuxCapabilities = []string{
+	"CHOWN", "DAC_OVERRIDE", "DAC_READ_SEARCH", "FOWNER", "FSETID", "KILL", "SETGID", "SETUID", "SETPCAP",
+	"LINUX_IMMUTABLE", "NET_BIND_SERVICE", "NET_BROADCAST", "NET_ADMIN", "NET_RAW", "IPC_LOCK", "IPC_OWNER",
+	"SYS_MODULE", "SYS_RAWIO", "SYS_CHROOT", "SYS_PTRACE", "SYS_PACCT", "SYS_ADMIN", "SYS_BOOT", "SYS_NICE",
+	"SYS_RESOURCE", "SYS_TIME", "SYS_TTY_CONFIG", "MKNOD", "LEASE", "AUDIT_WRITE", "AUDIT_CONTROL", "SETFCAP",
+	"MAC_OVERRIDE", "MAC_ADMIN", "SYSLOG", "WAKE_ALARM", "BLOCK_SUSPEND", "AUDIT_READ", "PERFMON", "BPF",
+	"CHECKPOINT_RESTORE",
+}
+
+// capabilityPattern matches ALL or a Linux capability name, with or without the CAP_ prefix.
+var capabilityPattern = regexp.MustCompile("^(ALL|(CAP_)?(" + strings.Join(linuxCapabilities, "|") + "))$")
 
 // Schema describes the deployment options of the Docker deployment mechanism.
 var Schema = schema.NewTypedScopeSchema[*Config](
@@ -20,8 +33,556 @@ var Schema = schema.NewTypedScopeSchema[*Config](
 			"deployment": schema.NewPropertySchema(
 				schema.NewRefSchema("Deployment", nil),
 				schema.NewDisplayValue(
-					schema.PointerTo("Deployment"),
-					schema.PointerTo("Deployment configuration for the plugin."),
+					schema.PointerTo("Deployment"),
+					schema.PointerTo("Deployment configuration for the plugin."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"podman": schema.NewPropertySchema(
+				schema.NewRefSchema("Podman", nil),
+				schema.NewDisplayValue(
+					schema.PointerTo("Podman"),
+					schema.PointerTo("Podman CLI configuration"),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"timeouts": schema.NewPropertySchema(
+				schema.NewRefSchema("Timeouts", nil),
+				schema.NewDisplayValue(
+					schema.PointerTo("Timeouts"),
+					schema.PointerTo("Timeouts for the podman commands run by the deployer."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+		},
+	),
+	schema.NewStructMappedObjectSchema[Podman](
+		"Podman",
+		map[string]*schema.PropertySchema{
+			"path": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, regexp.MustCompile("^.*$")),
+				schema.NewDisplayValue(schema.PointerTo("Podman path"), schema.PointerTo("Provides the path of podman executable"), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				schema.PointerTo(util.JSONEncode("podman")),
+				nil,
+			),
+			"containerNamePrefix": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, regexp.MustCompile("^.*$")),
+				schema.NewDisplayValue(
+					schema.PointerTo("Container Name Prefix"),
+					schema.PointerTo("Constant prefix prepended to the randomized container name string."),
+					nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"rngSeed": schema.NewPropertySchema(
+				schema.NewIntSchema(nil, nil, nil),
+				schema.NewDisplayValue(
+					schema.PointerTo("RngSeed"),
+					schema.PointerTo("Initial integer that is the starting point for a Random Number Generator's algorithm. Set this value for reproducible randomness."),
+					nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"connectionName": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("Connection"), schema.PointerTo("Connection name to use for remote podman"), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"url": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, regexp.MustCompile(`^(unix|tcp|ssh)://.+$`)),
+				schema.NewDisplayValue(
+					schema.PointerTo("URL"),
+					schema.PointerTo("URL of a remote podman service, for remote podman without a named connection."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				[]string{"connectionName"},
+				nil,
+				[]string{util.JSONEncode("ssh://core@engine.example.com:22/run/podman/podman.sock")},
+			).TreatEmptyAsDefaultValue(),
+			"identity": schema.NewPropertySchema(
+				schema.NewStringSchema(schema.IntPointer(1), nil, nil),
+				schema.NewDisplayValue(
+					schema.PointerTo("SSH identity"),
+					schema.PointerTo("Path of the SSH identity file on the engine host for an ssh:// URL."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			).TreatEmptyAsDefaultValue(),
+			"sensitivePatterns": schema.NewPropertySchema(
+				schema.NewListSchema(schema.NewStringSchema(schema.IntPointer(1), nil, nil), nil, nil),
+				schema.NewDisplayValue(
+					schema.PointerTo("Sensitive patterns"),
+					schema.PointerTo("Regular expressions whose matches are masked in the logged podman command lines "+
+						"and in the podman output included in errors. Environment variable values and registry "+
+						"credentials are always masked."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				[]string{util.JSONEncode([]string{`token=\S+`})},
+			),
+			"backend": schema.NewPropertySchema(
+				schema.NewStringEnumSchema(map[string]*schema.DisplayValue{
+					string(BackendCLI): {NameValue: schema.PointerTo("CLI")},
+					string(BackendAPI): {NameValue: schema.PointerTo("REST API")},
+				}),
+				schema.NewDisplayValue(
+					schema.PointerTo("Backend"),
+					schema.PointerTo("Run the podman CLI, or talk to the REST API of a podman service at the API URL."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				schema.PointerTo(util.JSONEncode(string(BackendCLI))),
+				nil,
+			).TreatEmptyAsDefaultValue(),
+			"apiURL": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, regexp.MustCompile(`^(unix|tcp)://.+$`)),
+				schema.NewDisplayValue(
+					schema.PointerTo("API URL"),
+					schema.PointerTo("URL of the podman service for the API backend. Forward remote services through an "+
+						"SSH tunnel."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				[]string{
+					util.JSONEncode("unix:///run/user/1000/podman/podman.sock"),
+					util.JSONEncode("tcp://localhost:8080"),
+				},
+			).TreatEmptyAsDefaultValue(),
+			"minimumVersion": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, regexp.MustCompile(`^\d+(\.\d+){0,2}$`)),
+				schema.NewDisplayValue(
+					schema.PointerTo("Minimum version"),
+					schema.PointerTo("Oldest podman version of the CLI and service the deployer accepts."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				schema.PointerTo(util.JSONEncode(DefaultMinimumVersion)),
+				nil,
+			).TreatEmptyAsDefaultValue(),
+		},
+	),
+	schema.NewStructMappedObjectSchema[Timeouts](
+		"Timeouts",
+		map[string]*schema.PropertySchema{
+			"imagePull": schema.NewPropertySchema(
+				schema.NewIntSchema(schema.IntPointer(0), nil, schema.UnitDurationNanoseconds),
+				schema.NewDisplayValue(schema.PointerTo("Image pull"), schema.PointerTo("Maximum duration of pulling the plugin image."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				schema.PointerTo(util.JSONEncode(DefaultImagePullTimeout)),
+				nil,
+			),
+			"containerStart": schema.NewPropertySchema(
+				schema.NewIntSchema(schema.IntPointer(0), nil, schema.UnitDurationNanoseconds),
+				schema.NewDisplayValue(schema.PointerTo("Container start"), schema.PointerTo("Maximum time for the plugin container to reach the running state."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				schema.PointerTo(util.JSONEncode(DefaultContainerStartTimeout)),
+				nil,
+			),
+			"atpHandshake": schema.NewPropertySchema(
+				schema.NewIntSchema(schema.IntPointer(0), nil, schema.UnitDurationNanoseconds),
+				schema.NewDisplayValue(schema.PointerTo("ATP handshake"), schema.PointerTo("Maximum time to wait for the plugin's first output after the container started."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				schema.PointerTo(util.JSONEncode(DefaultATPHandshakeTimeout)),
+				nil,
+			),
+			"kill": schema.NewPropertySchema(
+				schema.NewIntSchema(schema.IntPointer(0), nil, schema.UnitDurationNanoseconds),
+				schema.NewDisplayValue(schema.PointerTo("Kill"), schema.PointerTo("Maximum duration of killing the plugin container."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				schema.PointerTo(util.JSONEncode(DefaultKillTimeout)),
+				nil,
+			),
+			"remove": schema.NewPropertySchema(
+				schema.NewIntSchema(schema.IntPointer(0), nil, schema.UnitDurationNanoseconds),
+				schema.NewDisplayValue(schema.PointerTo("Remove"), schema.PointerTo("Maximum duration of removing the plugin container."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				schema.PointerTo(util.JSONEncode(DefaultRemoveTimeout)),
+				nil,
+			),
+			"secretCreate": schema.NewPropertySchema(
+				schema.NewIntSchema(schema.IntPointer(0), nil, schema.UnitDurationNanoseconds),
+				schema.NewDisplayValue(schema.PointerTo("Secret create"), schema.PointerTo("Maximum duration of creating a podman secret for the plugin container."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				schema.PointerTo(util.JSONEncode(DefaultSecretCreateTimeout)),
+				nil,
+			),
+			"probe": schema.NewPropertySchema(
+				schema.NewIntSchema(schema.IntPointer(0), nil, schema.UnitDurationNanoseconds),
+				schema.NewDisplayValue(schema.PointerTo("Probe"), schema.PointerTo("Maximum duration of detecting the podman version and host capabilities."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				schema.PointerTo(util.JSONEncode(DefaultProbeTimeout)),
+				nil,
+			),
+		},
+	),
+	schema.NewStructMappedObjectSchema[Deployment](
+		"Deployment",
+		map[string]*schema.PropertySchema{
+			"container": schema.NewPropertySchema(
+				schema.NewRefSchema("ContainerConfig", nil),
+				schema.NewDisplayValue(schema.PointerTo("Container configuration"), schema.PointerTo("Provides information about the container for the plugin."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"host": schema.NewPropertySchema(
+				schema.NewRefSchema("HostConfig", nil),
+				schema.NewDisplayValue(schema.PointerTo("Host configuration"), schema.PointerTo("Provides information about the container host for the plugin."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"podman": schema.NewPropertySchema(
+				schema.NewRefSchema("PodmanOptions", nil),
+				schema.NewDisplayValue(schema.PointerTo("Podman options"), schema.PointerTo("Podman-specific options for the plugin container."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"connectionName": schema.NewPropertySchema(
+				schema.NewStringSchema(schema.IntPointer(1), nil, nil),
+				schema.NewDisplayValue(
+					schema.PointerTo("Connection"),
+					schema.PointerTo("Podman connection to deploy the plugin through, overriding the connection of the podman configuration."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"imagePullPolicy": schema.NewPropertySchema(
+				schema.NewStringEnumSchema(map[string]*schema.DisplayValue{
+					string(ImagePullPolicyAlways):       {NameValue: schema.PointerTo("Always")},
+					string(ImagePullPolicyIfNotPresent): {NameValue: schema.PointerTo("If not present")},
+					string(ImagePullPolicyNever):        {NameValue: schema.PointerTo("Never")},
+				}),
+				schema.NewDisplayValue(schema.PointerTo("Image pull policy"), schema.PointerTo("When to pull the plugin image."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				schema.PointerTo(util.JSONEncode(string(ImagePullPolicyIfNotPresent))),
+				nil,
+			),
+			"imagePlatform": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, regexp.MustCompile("^.+/.+$")),
+				schema.NewDisplayValue(schema.PointerTo("Podman Image OS"), schema.PointerTo("Provides Podman Image Operating System and architecture"), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				[]string{"linux/amd64", "linux/arm64"},
+			),
+			"registries": schema.NewPropertySchema(
+				schema.NewListSchema(schema.NewRefSchema("Registry", nil), nil, nil),
+				schema.NewDisplayValue(
+					schema.PointerTo("Registries"),
+					schema.PointerTo("Credentials and TLS options for pulling plugin images from private or internal registries."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"imageVerification": schema.NewPropertySchema(
+				schema.NewRefSchema("ImageVerification", nil),
+				schema.NewDisplayValue(
+					schema.PointerTo("Image verification"),
+					schema.PointerTo("Restricts the plugin images which may be run to allowed digests or valid signatures."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"stopSignal": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, regexp.MustCompile(`^((SIG)?[A-Z][A-Z0-9]*([+-][0-9]+)?|[0-9]+)$`)),
+				schema.NewDisplayValue(
+					schema.PointerTo("Stop signal"),
+					schema.PointerTo("Signal sent to the plugin container if it is still running when the plugin is closed."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				schema.PointerTo(util.JSONEncode(DefaultStopSignal)),
+				[]string{util.JSONEncode("SIGTERM"), util.JSONEncode("SIGINT")},
+			).TreatEmptyAsDefaultValue(),
+			"envFiles": schema.NewPropertySchema(
+				schema.NewListSchema(schema.NewStringSchema(schema.IntPointer(1), nil, nil), nil, nil),
+				schema.NewDisplayValue(
+					schema.PointerTo("Env files"),
+					schema.PointerTo("Paths of env files on the engine host with one KEY=value entry per line, whose variables are set on the plugin container. Lines starting with # are ignored."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"envPassthrough": schema.NewPropertySchema(
+				schema.NewListSchema(schema.NewStringSchema(schema.IntPointer(1), nil, regexp.MustCompile(`^[^=\s]+$`)), nil, nil),
+				schema.NewDisplayValue(
+					schema.PointerTo("Environment passthrough"),
+					schema.PointerTo("Names or glob patterns of engine environment variables to forward to the plugin container, for example HTTPS_PROXY or AWS_*. Configured environment variables take precedence."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				[]string{util.JSONEncode([]string{"HTTPS_PROXY", "AWS_*"})},
+			),
+			"mounts": schema.NewPropertySchema(
+				schema.NewListSchema(schema.NewRefSchema("Mount", nil), nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("Mounts"), schema.PointerTo("Bind, volume, tmpfs and image mounts of the plugin container."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"secrets": schema.NewPropertySchema(
+				schema.NewListSchema(schema.NewRefSchema("Secret", nil), nil, nil),
+				schema.NewDisplayValue(
+					schema.PointerTo("Secrets"),
+					schema.PointerTo("Credentials passed to the plugin container through podman secrets, which are "+
+						"created for the deployment and removed when the plugin is closed."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"extraArgs": schema.NewPropertySchema(
+				schema.NewListSchema(schema.NewStringSchema(schema.IntPointer(1), nil, nil), nil, nil),
+				schema.NewDisplayValue(
+					schema.PointerTo("Extra arguments"),
+					schema.PointerTo("Additional podman run arguments for options the deployer does not support yet. "+
+						"Flags the deployer relies on, such as --attach, --interactive, --detach, --name or --rm, are rejected. "+
+						"Every argument must be a flag or the value of the flag before it. "+
+						"Flags the deployer does not know must be passed with their value as one argument, --flag=value."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				[]string{util.JSONEncode([]string{"--label", "team=perf"})},
+			),
+			"gracePeriod": schema.NewPropertySchema(
+				schema.NewIntSchema(schema.IntPointer(0), nil, schema.UnitDurationNanoseconds),
+				schema.NewDisplayValue(
+					schema.PointerTo("Grace period"),
+					schema.PointerTo("Time the plugin container has to exit after the stop signal, before it is killed. Zero kills it immediately, like podman stop --time 0."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				schema.PointerTo(util.JSONEncode(DefaultGracePeriod)),
+				nil,
+			),
+		},
+	),
+	schema.NewStructMappedObjectSchema[*ImageVerification](
+		"ImageVerification",
+		map[string]*schema.PropertySchema{
+			"allowedDigests": schema.NewPropertySchema(
+				schema.NewListSchema(
+					schema.NewStringSchema(nil, nil, regexp.MustCompile(`^sha(256:[a-f0-9]{64}|512:[a-f0-9]{128})$`)),
+					nil,
+					nil,
+				),
+				schema.NewDisplayValue(
+					schema.PointerTo("Allowed digests"),
+					schema.PointerTo("Digests of the plugin images which may be run. An image is allowed if one of its "+
+						"repository digests, including the manifest list digest of multi-platform images, is in the list."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				[]string{util.JSONEncode([]string{"sha256:3f0f3e8a2b6d1c6a9e5d4b7c8a1f2e3d4c5b6a7988776655443322110ffeeddc"})},
+			),
+			"signaturePolicy": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, nil),
+				schema.NewDisplayValue(
+					schema.PointerTo("Signature policy"),
+					schema.PointerTo("Path of a containers-policy.json file on the engine host which the signatures of "+
+						"pulled images are verified against. Requires the Always image pull policy and a local podman."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				[]string{util.JSONEncode("/etc/containers/policy.json")},
+			).TreatEmptyAsDefaultValue(),
+		},
+	),
+	schema.NewStructMappedObjectSchema[Registry](
+		"Registry",
+		map[string]*schema.PropertySchema{
+			"host": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, regexp.MustCompile(`^[a-zA-Z0-9.-]+(:[0-9]+)?(/[a-z0-9._-]+)*$`)),
+				schema.NewDisplayValue(
+					schema.PointerTo("Host"),
+					schema.PointerTo("Registry host, optionally with a port and a repository path. The most specific registry matching the image is used."),
+					nil,
+				),
+				true,
+				nil,
+				nil,
+				nil,
+				nil,
+				[]string{util.JSONEncode("quay.io"), util.JSONEncode("registry.example.com:5000/plugins")},
+			),
+			"username": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("Username"), schema.PointerTo("Username for the registry. Requires a password."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			).TreatEmptyAsDefaultValue(),
+			"password": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("Password"), schema.PointerTo("Password for the registry. Requires a username."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			).TreatEmptyAsDefaultValue(),
+			"token": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("Token"), schema.PointerTo("Identity token for the registry."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			).TreatEmptyAsDefaultValue(),
+			"authFile": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, nil),
+				schema.NewDisplayValue(
+					schema.PointerTo("Authentication file"),
+					schema.PointerTo("Path of an authentication file on the engine host in the containers-auth.json format."),
 					nil,
 				),
 				false,
@@ -30,12 +591,12 @@ var Schema = schema.NewTypedScopeSchema[*Config](
 				nil,
 				nil,
 				nil,
-			),
-			"podman": schema.NewPropertySchema(
-				schema.NewRefSchema("Podman", nil),
+			).TreatEmptyAsDefaultValue(),
+			"tlsVerify": schema.NewPropertySchema(
+				schema.NewBoolSchema(),
 				schema.NewDisplayValue(
-					schema.PointerTo("Podman"),
-					schema.PointerTo("Podman CLI configuration"),
+					schema.PointerTo("TLS verify"),
+					schema.PointerTo("Verify the certificate of the registry. Unset keeps the podman default."),
 					nil,
 				),
 				false,
@@ -45,50 +606,182 @@ var Schema = schema.NewTypedScopeSchema[*Config](
 				nil,
 				nil,
 			),
+			"certDir": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, nil),
+				schema.NewDisplayValue(
+					schema.PointerTo("Certificate directory"),
+					schema.PointerTo("Directory on the engine host containing the certificates for the registry. "+
+						"Requires a local podman."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			).TreatEmptyAsDefaultValue(),
 		},
 	),
-	schema.NewStructMappedObjectSchema[Podman](
-		"Podman",
+	schema.NewStructMappedObjectSchema[Secret](
+		"Secret",
 		map[string]*schema.PropertySchema{
-			"path": schema.NewPropertySchema(
-				schema.NewStringSchema(nil, nil, regexp.MustCompile("^.*$")),
-				schema.NewDisplayValue(schema.PointerTo("Podman path"), schema.PointerTo("Provides the path of podman executable"), nil),
-				false,
+			"name": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]*$`)),
+				schema.NewDisplayValue(
+					schema.PointerTo("Name"),
+					schema.PointerTo("Name of the secret, also used as the file name or environment variable name unless a target is set."),
+					nil,
+				),
+				true,
 				nil,
 				nil,
 				nil,
-				schema.PointerTo(util.JSONEncode("podman")),
 				nil,
+				[]string{util.JSONEncode("api_token")},
 			),
-			"containerNamePrefix": schema.NewPropertySchema(
-				schema.NewStringSchema(nil, nil, regexp.MustCompile("^.*$")),
+			"value": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("Value"), schema.PointerTo("Value of the secret. Either a value or a file is required."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			).TreatEmptyAsDefaultValue(),
+			"file": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, nil),
 				schema.NewDisplayValue(
-					schema.PointerTo("Container Name Prefix"),
-					schema.PointerTo("Constant prefix prepended to the randomized container name string."),
-					nil),
+					schema.PointerTo("File"),
+					schema.PointerTo("Path of a file on the engine host containing the value of the secret. Either a value or a file is required."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			).TreatEmptyAsDefaultValue(),
+			"type": schema.NewPropertySchema(
+				schema.NewStringEnumSchema(map[string]*schema.DisplayValue{
+					string(SecretTypeMount): {NameValue: schema.PointerTo("File")},
+					string(SecretTypeEnv):   {NameValue: schema.PointerTo("Environment variable")},
+				}),
+				schema.NewDisplayValue(schema.PointerTo("Type"), schema.PointerTo("Expose the secret as a file or as an environment variable."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				schema.PointerTo(util.JSONEncode(string(SecretTypeMount))),
+				nil,
+			).TreatEmptyAsDefaultValue(),
+			"target": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, nil),
+				schema.NewDisplayValue(
+					schema.PointerTo("Target"),
+					schema.PointerTo("Path of the secret file, absolute or relative to /run/secrets, or name of the environment variable. Defaults to the name."),
+					nil,
+				),
 				false,
 				nil,
 				nil,
 				nil,
 				nil,
 				nil,
+			).TreatEmptyAsDefaultValue(),
+		},
+	),
+	schema.NewStructMappedObjectSchema[Mount](
+		"Mount",
+		map[string]*schema.PropertySchema{
+			"type": schema.NewPropertySchema(
+				schema.NewStringEnumSchema(map[string]*schema.DisplayValue{
+					string(MountTypeBind):   {NameValue: schema.PointerTo("Bind")},
+					string(MountTypeVolume): {NameValue: schema.PointerTo("Volume")},
+					string(MountTypeTmpfs):  {NameValue: schema.PointerTo("Tmpfs")},
+					string(MountTypeImage):  {NameValue: schema.PointerTo("Image")},
+				}),
+				schema.NewDisplayValue(schema.PointerTo("Type"), schema.PointerTo("Type of the mount."), nil),
+				true,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
 			),
-			"rngSeed": schema.NewPropertySchema(
-				schema.NewIntSchema(nil, nil, nil),
+			"source": schema.NewPropertySchema(
+				schema.NewStringSchema(schema.IntPointer(1), nil, nil),
 				schema.NewDisplayValue(
-					schema.PointerTo("RngSeed"),
-					schema.PointerTo("Initial integer that is the starting point for a Random Number Generator's algorithm. Set this value for reproducible randomness."),
-					nil),
+					schema.PointerTo("Source"),
+					schema.PointerTo("Absolute host path of a bind mount, name of a volume or image of an image mount. Not allowed for tmpfs mounts."),
+					nil,
+				),
 				false,
 				nil,
 				nil,
 				nil,
 				nil,
 				nil,
+			).TreatEmptyAsDefaultValue(),
+			"target": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, regexp.MustCompile("^/")),
+				schema.NewDisplayValue(schema.PointerTo("Target"), schema.PointerTo("Absolute path of the mount in the container."), nil),
+				true,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
 			),
-			"connectionName": schema.NewPropertySchema(
-				schema.NewStringSchema(nil, nil, nil),
-				schema.NewDisplayValue(schema.PointerTo("Connection"), schema.PointerTo("Connection name to use for remote podman"), nil),
+			"readOnly": schema.NewPropertySchema(
+				schema.NewBoolSchema(),
+				schema.NewDisplayValue(schema.PointerTo("Read-only"), schema.PointerTo("Mount read-only."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				schema.PointerTo(util.JSONEncode(false)),
+				nil,
+			),
+			"relabel": schema.NewPropertySchema(
+				schema.NewStringEnumSchema(map[string]*schema.DisplayValue{
+					string(MountRelabelShared):  {NameValue: schema.PointerTo("Shared")},
+					string(MountRelabelPrivate): {NameValue: schema.PointerTo("Private")},
+				}),
+				schema.NewDisplayValue(
+					schema.PointerTo("SELinux relabel"),
+					schema.PointerTo("Relabel the source of a bind mount for SELinux, so that all containers (shared) or only the plugin container (private) can use it."),
+					nil,
+				),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			).TreatEmptyAsDefaultValue(),
+			"propagation": schema.NewPropertySchema(
+				schema.NewStringEnumSchema(map[string]*schema.DisplayValue{
+					"private":  {NameValue: schema.PointerTo("Private")},
+					"rprivate": {NameValue: schema.PointerTo("Recursive private")},
+					"shared":   {NameValue: schema.PointerTo("Shared")},
+					"rshared":  {NameValue: schema.PointerTo("Recursive shared")},
+					"slave":    {NameValue: schema.PointerTo("Slave")},
+					"rslave":   {NameValue: schema.PointerTo("Recursive slave")},
+				}),
+				schema.NewDisplayValue(schema.PointerTo("Propagation"), schema.PointerTo("Mount propagation of a bind mount."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			).TreatEmptyAsDefaultValue(),
+			"size": schema.NewPropertySchema(
+				schema.NewIntSchema(schema.IntPointer(0), nil, schema.UnitBytes),
+				schema.NewDisplayValue(schema.PointerTo("Size"), schema.PointerTo("Size limit of a tmpfs mount in bytes. No limit if 0."), nil),
 				false,
 				nil,
 				nil,
@@ -98,22 +791,56 @@ var Schema = schema.NewTypedScopeSchema[*Config](
 			),
 		},
 	),
-	schema.NewStructMappedObjectSchema[Deployment](
-		"Deployment",
+	schema.NewStructMappedObjectSchema[*PodmanOptions](
+		"PodmanOptions",
 		map[string]*schema.PropertySchema{
-			"container": schema.NewPropertySchema(
-				schema.NewRefSchema("ContainerConfig", nil),
-				schema.NewDisplayValue(schema.PointerTo("Container configuration"), schema.PointerTo("Provides information about the container for the plugin."), nil),
+			"userns": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, regexp.MustCompile(
+					"^(auto(:.+)?|host|keep-id(:(uid|gid|size)=[0-9]+(,(uid|gid|size)=[0-9]+)*)?|nomap|private|ns:.+|container:.+)$",
+				)),
+				schema.NewDisplayValue(schema.PointerTo("User namespace"), schema.PointerTo("User namespace mode of the container, for example keep-id or auto. Cannot be combined with UID or GID maps."), nil),
 				false,
 				nil,
 				nil,
 				nil,
 				nil,
+				[]string{util.JSONEncode("keep-id"), util.JSONEncode("auto")},
+			).TreatEmptyAsDefaultValue(),
+			"uidmap": schema.NewPropertySchema(
+				schema.NewListSchema(schema.NewStringSchema(nil, nil, regexp.MustCompile(`^\+?[0-9]+:@?[0-9]+:[0-9]+$`)), nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("UID map"), schema.PointerTo("UID mappings of the user namespace in the container_uid:from_uid:amount format. Cannot be combined with a user namespace mode."), nil),
+				false,
+				nil,
+				nil,
+				nil,
 				nil,
+				[]string{util.JSONEncode([]string{"0:1:1000"})},
 			),
-			"host": schema.NewPropertySchema(
-				schema.NewRefSchema("HostConfig", nil),
-				schema.NewDisplayValue(schema.PointerTo("Host configuration"), schema.PointerTo("Provides information about the container host for the plugin."), nil),
+			"gidmap": schema.NewPropertySchema(
+				schema.NewListSchema(schema.NewStringSchema(nil, nil, regexp.MustCompile(`^\+?[0-9]+:@?[0-9]+:[0-9]+$`)), nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("GID map"), schema.PointerTo("GID mappings of the user namespace in the container_gid:from_gid:amount format. Cannot be combined with a user namespace mode."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				[]string{util.JSONEncode([]string{"0:1:1000"})},
+			),
+			"pod": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, regexp.MustCompile("^(new:)?[a-zA-Z0-9][a-zA-Z0-9_.-]*$")),
+				schema.NewDisplayValue(schema.PointerTo("Pod"), schema.PointerTo("Existing pod to run the container in, or new:name to create a new pod."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			).TreatEmptyAsDefaultValue(),
+			"secrets": schema.NewPropertySchema(
+				schema.NewListSchema(schema.NewStringSchema(nil, nil, regexp.MustCompile(
+					"^[a-zA-Z0-9][a-zA-Z0-9_.-]*(,(type|target|uid|gid|mode)=[^,]+)*$",
+				)), nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("Secrets"), schema.PointerTo("Podman secrets to expose to the container, optionally followed by options, for example token,type=env,target=TOKEN."), nil),
 				false,
 				nil,
 				nil,
@@ -121,30 +848,44 @@ var Schema = schema.NewTypedScopeSchema[*Config](
 				nil,
 				nil,
 			),
-			"imagePullPolicy": schema.NewPropertySchema(
-				schema.NewStringEnumSchema(map[string]*schema.DisplayValue{
-					string(ImagePullPolicyAlways):       {NameValue: schema.PointerTo("Always")},
-					string(ImagePullPolicyIfNotPresent): {NameValue: schema.PointerTo("If not present")},
-					string(ImagePullPolicyNever):        {NameValue: schema.PointerTo("Never")},
-				}),
-				schema.NewDisplayValue(schema.PointerTo("Image pull policy"), schema.PointerTo("When to pull the plugin image."), nil),
+			"securityOpt": schema.NewPropertySchema(
+				schema.NewListSchema(schema.NewStringSchema(nil, nil, regexp.MustCompile(
+					"^(label=(disable|nested|(user|role|type|level|filetype):.+)|no-new-privileges(=(true|false))?|"+
+						"seccomp=.+|apparmor=.+|mask=.+|unmask=.+|proc-opts=.+)$",
+				)), nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("Security options"), schema.PointerTo("Security options of the container, for example label=disable or no-new-privileges."), nil),
 				false,
 				nil,
 				nil,
 				nil,
-				schema.PointerTo(util.JSONEncode(string(ImagePullPolicyIfNotPresent))),
+				nil,
 				nil,
 			),
-			"imagePlatform": schema.NewPropertySchema(
-				schema.NewStringSchema(nil, nil, regexp.MustCompile("^.+/.+$")),
-				schema.NewDisplayValue(schema.PointerTo("Podman Image OS"), schema.PointerTo("Provides Podman Image Operating System and architecture"), nil),
+			"readOnlyTmpfs": schema.NewPropertySchema(
+				schema.NewBoolSchema(),
+				schema.NewDisplayValue(schema.PointerTo("Read-only tmpfs"), schema.PointerTo("Mount read-write tmpfs directories on /dev, /dev/shm, /run, /tmp and /var/tmp of a read-only container."), nil),
 				false,
 				nil,
 				nil,
 				nil,
 				nil,
-				[]string{"linux/amd64", "linux/arm64"},
+				nil,
 			),
+			"sdnotify": schema.NewPropertySchema(
+				schema.NewStringEnumSchema(map[string]*schema.DisplayValue{
+					string(SDNotifyModeContainer): {NameValue: schema.PointerTo("Container")},
+					string(SDNotifyModeConmon):    {NameValue: schema.PointerTo("Conmon")},
+					string(SDNotifyModeHealthy):   {NameValue: schema.PointerTo("Healthy")},
+					string(SDNotifyModeIgnore):    {NameValue: schema.PointerTo("Ignore")},
+				}),
+				schema.NewDisplayValue(schema.PointerTo("sd-notify mode"), schema.PointerTo("How the readiness of the container is reported to systemd."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			).TreatEmptyAsDefaultValue(),
 		},
 	),
 	schema.NewStructMappedObjectSchema[*container.Config](
@@ -159,7 +900,7 @@ var Schema = schema.NewTypedScopeSchema[*Config](
 				nil,
 				nil,
 				nil,
-			).Disable(notImplemented),
+			).TreatEmptyAsDefaultValue(),
 			"Domainname": schema.NewPropertySchema(
 				schema.NewStringSchema(schema.IntPointer(1), schema.IntPointer(255), regexp.MustCompile("^[a-zA-Z0-9-_.]+$")),
 				schema.NewDisplayValue(schema.PointerTo("Domain name"), schema.PointerTo("Domain name for the plugin container."), nil),
@@ -169,20 +910,24 @@ var Schema = schema.NewTypedScopeSchema[*Config](
 				nil,
 				nil,
 				nil,
-			).Disable(notImplemented),
+			).TreatEmptyAsDefaultValue(),
 			"User": schema.NewPropertySchema(
-				schema.NewStringSchema(schema.IntPointer(1), schema.IntPointer(255), regexp.MustCompile("^[a-z_][a-z0-9_-]*[$]?(:[a-z_][a-z0-9_-]*[$]?)$")),
-				schema.NewDisplayValue(schema.PointerTo("Username"), schema.PointerTo("User that will run the command inside the container. Optionally, a group can be specified in the user:group format."), nil),
+				schema.NewStringSchema(schema.IntPointer(1), schema.IntPointer(255), regexp.MustCompile(`^([a-z_][a-z0-9_-]*[$]?|[0-9]+)(:([a-z_][a-z0-9_-]*[$]?|[0-9]+))?$`)),
+				schema.NewDisplayValue(schema.PointerTo("Username"), schema.PointerTo("User name or UID that will run the command inside the container. Optionally, a group name or GID can be specified in the user:group format."), nil),
 				false,
 				nil,
 				nil,
 				nil,
 				nil,
 				nil,
-			).Disable(notImplemented),
+			).TreatEmptyAsDefaultValue(),
 			"Env": schema.NewPropertySchema(
-				schema.NewListSchema(schema.NewStringSchema(schema.IntPointer(1), schema.IntPointer(32760), regexp.MustCompile("^.+=.+$")), nil, nil),
-				schema.NewDisplayValue(schema.PointerTo("Environment variables"), schema.PointerTo("Environment variables to set on the plugin container."), nil),
+				schema.NewListSchema(schema.NewStringSchema(schema.IntPointer(1), schema.IntPointer(32760), regexp.MustCompile("^[^=]+(=.*)?$")), nil, nil),
+				schema.NewDisplayValue(
+					schema.PointerTo("Environment variables"),
+					schema.PointerTo("Environment variables to set on the plugin container in the KEY=value format. A KEY without a value inherits the variable from the environment of the engine."),
+					nil,
+				),
 				false,
 				nil,
 				nil,
@@ -199,7 +944,7 @@ var Schema = schema.NewTypedScopeSchema[*Config](
 				nil,
 				nil,
 				nil,
-			).Disable(notImplemented),
+			),
 			"MacAddress": schema.NewPropertySchema(
 				schema.NewStringSchema(nil, nil, regexp.MustCompile("^[a-fA-F0-9]{2}(:[a-fA-F0-9]{2}){5}$")),
 				schema.NewDisplayValue(schema.PointerTo("MAC address"), schema.PointerTo("Media Access Control address for the container."), nil),
@@ -209,7 +954,7 @@ var Schema = schema.NewTypedScopeSchema[*Config](
 				nil,
 				nil,
 				nil,
-			).Disable(notImplemented),
+			).TreatEmptyAsDefaultValue(),
 		},
 	),
 	schema.NewStructMappedObjectSchema[*container.HostConfig](
@@ -243,7 +988,7 @@ var Schema = schema.NewTypedScopeSchema[*Config](
 			),
 			"PortBindings": schema.NewPropertySchema(
 				schema.NewMapSchema(
-					schema.NewStringSchema(nil, nil, regexp.MustCompile("^[0-9]+(/[a-zA-Z0-9]+)$")),
+					newPortSchema(),
 					schema.NewListSchema(
 						schema.NewRefSchema("PortBinding", nil),
 						nil,
@@ -252,34 +997,34 @@ var Schema = schema.NewTypedScopeSchema[*Config](
 					nil,
 					nil,
 				),
-				schema.NewDisplayValue(schema.PointerTo("Port bindings"), schema.PointerTo("Ports to expose on the host machine. Ports are specified in the format of portnumber/protocol."), nil),
+				schema.NewDisplayValue(schema.PointerTo("Port bindings"), schema.PointerTo("Container ports to publish on the host machine, keyed by the container port or port range in the port/protocol format, for example 8080/tcp or 9000-9010/udp. An empty list of bindings publishes the port on a random host port."), nil),
 				false,
 				nil,
 				nil,
 				nil,
 				nil,
 				nil,
-			).Disable(notImplemented),
+			),
 			"CapAdd": schema.NewPropertySchema(
-				schema.NewListSchema(schema.NewStringSchema(nil, nil, nil), nil, nil),
-				schema.NewDisplayValue(schema.PointerTo("Add capabilities"), schema.PointerTo("Add capabilities to the container."), nil),
+				schema.NewListSchema(schema.NewStringSchema(nil, nil, capabilityPattern), nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("Add capabilities"), schema.PointerTo("Capabilities to add to the container, for example NET_RAW or CAP_NET_RAW. ALL adds all capabilities."), nil),
 				false,
 				nil,
 				nil,
 				nil,
 				nil,
 				nil,
-			).Disable(notImplemented),
+			),
 			"CapDrop": schema.NewPropertySchema(
-				schema.NewListSchema(schema.NewStringSchema(nil, nil, nil), nil, nil),
-				schema.NewDisplayValue(schema.PointerTo("Drop capabilities"), schema.PointerTo("Drop capabilities from the container."), nil),
+				schema.NewListSchema(schema.NewStringSchema(nil, nil, capabilityPattern), nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("Drop capabilities"), schema.PointerTo("Capabilities to drop from the container, for example NET_RAW or CAP_NET_RAW. ALL drops all capabilities."), nil),
 				false,
 				nil,
 				nil,
 				nil,
 				nil,
 				nil,
-			).Disable(notImplemented),
+			),
 			"CgroupnsMode": schema.NewPropertySchema(
 				schema.NewStringSchema(nil, nil, regexp.MustCompile("host|private|ns:.+|container:.+")),
 				schema.NewDisplayValue(schema.PointerTo("CGroup namespace mode"), schema.PointerTo("CGroup namespace mode to use for the container."), nil),
@@ -291,45 +1036,45 @@ var Schema = schema.NewTypedScopeSchema[*Config](
 				nil,
 			),
 			"Dns": schema.NewPropertySchema(
-				schema.NewListSchema(schema.NewStringSchema(nil, nil, nil), nil, nil),
-				schema.NewDisplayValue(schema.PointerTo("DNS servers"), schema.PointerTo("DNS servers to use for lookup."), nil),
+				schema.NewListSchema(schema.NewStringSchema(nil, nil, regexp.MustCompile(`^([0-9]{1,3}(\.[0-9]{1,3}){3}|[0-9a-fA-F]*:[0-9a-fA-F:.]*)$`)), nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("DNS servers"), schema.PointerTo("IP addresses of the DNS servers to use for lookup."), nil),
 				false,
 				nil,
 				nil,
 				nil,
 				nil,
 				nil,
-			).Disable(notImplemented),
+			),
 			"DnsOptions": schema.NewPropertySchema(
-				schema.NewListSchema(schema.NewStringSchema(nil, nil, nil), nil, nil),
-				schema.NewDisplayValue(schema.PointerTo("DNS options"), schema.PointerTo("DNS options to look for."), nil),
+				schema.NewListSchema(schema.NewStringSchema(nil, nil, regexp.MustCompile(`^[a-zA-Z0-9_-]+(:[^\s]+)?$`)), nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("DNS options"), schema.PointerTo("DNS resolver options, for example ndots:2."), nil),
 				false,
 				nil,
 				nil,
 				nil,
 				nil,
 				nil,
-			).Disable(notImplemented),
+			),
 			"DnsSearch": schema.NewPropertySchema(
-				schema.NewListSchema(schema.NewStringSchema(nil, nil, nil), nil, nil),
-				schema.NewDisplayValue(schema.PointerTo("DNS search"), schema.PointerTo("DNS search domain."), nil),
+				schema.NewListSchema(schema.NewStringSchema(schema.IntPointer(1), schema.IntPointer(253), regexp.MustCompile(`^([a-zA-Z0-9-_.]+|\.)$`)), nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("DNS search"), schema.PointerTo("DNS search domains. A single . disables the search domains."), nil),
 				false,
 				nil,
 				nil,
 				nil,
 				nil,
 				nil,
-			).Disable(notImplemented),
+			),
 			"ExtraHosts": schema.NewPropertySchema(
-				schema.NewListSchema(schema.NewStringSchema(nil, nil, nil), nil, nil),
-				schema.NewDisplayValue(schema.PointerTo("Extra hosts"), schema.PointerTo("Extra hosts entries to add"), nil),
+				schema.NewListSchema(schema.NewStringSchema(nil, nil, regexp.MustCompile(`^[a-zA-Z0-9-_.]+(;[a-zA-Z0-9-_.]+)*:(host-gateway|[0-9]{1,3}(\.[0-9]{1,3}){3}|[0-9a-fA-F]*:[0-9a-fA-F:.]*)$`)), nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("Extra hosts"), schema.PointerTo("Extra /etc/hosts entries in the host:ip format."), nil),
 				false,
 				nil,
 				nil,
 				nil,
 				nil,
 				nil,
-			).Disable(notImplemented),
+			),
 			"Privileged": schema.NewPropertySchema(
 				schema.NewBoolSchema(),
 				schema.NewDisplayValue(schema.PointerTo("Privileged"), schema.PointerTo("Execute container process without security features that isolate the container from the host"), nil),
@@ -340,31 +1085,160 @@ var Schema = schema.NewTypedScopeSchema[*Config](
 				schema.PointerTo(util.JSONEncode(false)),
 				nil,
 			),
+			"Memory": schema.NewPropertySchema(
+				schema.NewIntSchema(schema.IntPointer(0), nil, schema.UnitBytes),
+				schema.NewDisplayValue(schema.PointerTo("Memory limit"), schema.PointerTo("Memory limit of the container in bytes. The container is killed if it exceeds the limit. No limit if 0."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				[]string{util.JSONEncode("512MB")},
+			),
+			"MemorySwap": schema.NewPropertySchema(
+				schema.NewIntSchema(schema.IntPointer(-1), nil, schema.UnitBytes),
+				schema.NewDisplayValue(schema.PointerTo("Memory and swap limit"), schema.PointerTo("Limit of the memory plus swap of the container in bytes. Requires a memory limit. Unlimited swap if -1, twice the memory limit if 0."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"NanoCpus": schema.NewPropertySchema(
+				schema.NewIntSchema(schema.IntPointer(0), nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("CPU limit"), schema.PointerTo("Number of CPUs the container can use in units of 10^-9 CPUs, for example 1500000000 for 1.5 CPUs. No limit if 0."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				[]string{"1500000000"},
+			),
+			"CpuShares": schema.NewPropertySchema(
+				schema.NewIntSchema(schema.IntPointer(0), schema.IntPointer(262144), nil),
+				schema.NewDisplayValue(schema.PointerTo("CPU shares"), schema.PointerTo("CPU shares of the container, relative to other containers. The default weight is 1024."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"CpusetCpus": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, regexp.MustCompile("^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$")),
+				schema.NewDisplayValue(schema.PointerTo("CPU set"), schema.PointerTo("CPUs the container is allowed to run on, for example 0-3 or 0,2."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			).TreatEmptyAsDefaultValue(),
+			"PidsLimit": schema.NewPropertySchema(
+				schema.NewIntSchema(schema.IntPointer(-1), nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("PIDs limit"), schema.PointerTo("Maximum number of processes in the container. Unlimited if -1."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"Ulimits": schema.NewPropertySchema(
+				schema.NewListSchema(schema.NewRefSchema("Ulimit", nil), nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("Ulimits"), schema.PointerTo("Resource limits of the processes in the container."), nil),
+				false,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
 		},
 	),
-	schema.NewStructMappedObjectSchema[*nat.PortBinding](
+	schema.NewStructMappedObjectSchema[nat.PortBinding](
 		"PortBinding",
 		map[string]*schema.PropertySchema{
 			"HostIP": schema.NewPropertySchema(
-				schema.NewStringSchema(nil, nil, nil),
-				schema.NewDisplayValue(schema.PointerTo("Host IP"), nil, nil),
+				schema.NewStringSchema(nil, nil, regexp.MustCompile(`^([0-9]{1,3}(\.[0-9]{1,3}){3}|[0-9a-fA-F]*:[0-9a-fA-F:.]*)$`)),
+				schema.NewDisplayValue(schema.PointerTo("Host IP"), schema.PointerTo("Host IP address to bind the port to. Binds to all addresses if empty."), nil),
 				false,
 				nil,
 				nil,
 				nil,
 				nil,
 				nil,
-			).Disable(notImplemented),
+			).TreatEmptyAsDefaultValue(),
 			"HostPort": schema.NewPropertySchema(
-				schema.NewStringSchema(nil, nil, regexp.MustCompile("^0-9+$")),
-				schema.NewDisplayValue(schema.PointerTo("Host port"), nil, nil),
+				schema.NewStringSchema(nil, nil, regexp.MustCompile("^[0-9]+(-[0-9]+)?$")),
+				schema.NewDisplayValue(schema.PointerTo("Host port"), schema.PointerTo("Host port or port range to bind to. A random host port is chosen if empty."), nil),
 				false,
 				nil,
 				nil,
 				nil,
 				nil,
 				nil,
-			).Disable(notImplemented),
+			).TreatEmptyAsDefaultValue(),
+		},
+	),
+	schema.NewStructMappedObjectSchema[*container.Ulimit](
+		"Ulimit",
+		map[string]*schema.PropertySchema{
+			"Name": schema.NewPropertySchema(
+				schema.NewStringSchema(nil, nil, regexp.MustCompile(
+					"^(core|cpu|data|fsize|locks|memlock|msgqueue|nice|nofile|nproc|rss|rtprio|rttime|sigpending|stack)$",
+				)),
+				schema.NewDisplayValue(schema.PointerTo("Name"), schema.PointerTo("Name of the limited resource, for example nofile or nproc."), nil),
+				true,
+				nil,
+				nil,
+				nil,
+				nil,
+				[]string{util.JSONEncode("nofile")},
+			),
+			"Soft": schema.NewPropertySchema(
+				schema.NewIntSchema(schema.IntPointer(-1), nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("Soft limit"), schema.PointerTo("Soft limit of the resource. Unlimited if -1."), nil),
+				true,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
+			"Hard": schema.NewPropertySchema(
+				schema.NewIntSchema(schema.IntPointer(-1), nil, nil),
+				schema.NewDisplayValue(schema.PointerTo("Hard limit"), schema.PointerTo("Hard limit of the resource. Unlimited if -1."), nil),
+				true,
+				nil,
+				nil,
+				nil,
+				nil,
+				nil,
+			),
 		},
 	),
 )
+
+// portSchema is a string schema unserializing to nat.Port, so that the port bindings map can be stored in a
+// nat.PortMap.
+type portSchema struct {
+	*schema.StringSchema
+}
+
+func newPortSchema() portSchema {
+	return portSchema{schema.NewStringSchema(nil, nil, regexp.MustCompile("^[0-9]+(-[0-9]+)?(/(tcp|udp|sctp))?$"))}
+}
+
+func (p portSchema) ReflectedType() reflect.Type {
+	return reflect.TypeOf(nat.Port(""))
+}
+
+func (p portSchema) Unserialize(data any) (any, error) {
+	port, err := p.UnserializeType(data)
+	if err != nil {
+		return nil, err
+	}
+	return nat.Port(port), nil
+}
@@ -0,0 +1,147 @@
+package podman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	"go.flow.arcalot.io/podmandeployer/internal/cliwrapper"
+)
+
+// SecretType determines how a secret is exposed to the plugin container.
+type SecretType string
+
+const (
+	// SecretTypeMount exposes the secret as a file, by default under /run/secrets.
+	SecretTypeMount SecretType = "mount"
+	// SecretTypeEnv exposes the secret as an environment variable.
+	SecretTypeEnv SecretType = "env"
+)
+
+// Secret is a credential passed to the plugin container through an ephemeral podman secret, which is created for the
+// deployment and removed when the plugin is closed.
+type Secret struct {
+	// Name identifies the secret. It is also the name of the file under /run/secrets or of the environment variable
+	// unless Target is set.
+	Name string `json:"name"`
+	// Value is the secret value. Exactly one of Value and File must be set.
+	Value string `json:"value"`
+	// File is the path of a file on the engine host containing the secret value.
+	File string     `json:"file"`
+	Type SecretType `json:"type"`
+	// Target is the path of the secret file, absolute or relative to /run/secrets, or the name of the environment
+	// variable.
+	Target string `json:"target"`
+}
+
+// envNamePattern matches the environment variable names a secret can be exposed as.
+var envNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// validate checks the combination of secret options, which the schema cannot express.
+func (s Secret) validate() error {
+	switch {
+	case s.Value == "" && s.File == "":
+		return fmt.Errorf("the secret %s requires either a value or a file", s.Name)
+	case s.Value != "" && s.File != "":
+		return fmt.Errorf("the secret %s cannot have both a value and a file", s.Name)
+	case s.Type == SecretTypeEnv && !envNamePattern.MatchString(s.target()):
+		return fmt.Errorf("the secret %s cannot be exposed as the environment variable %q", s.Name, s.target())
+	}
+	return nil
+}
+
+// target returns the target of the secret in the container, defaulting to its name.
+func (s Secret) target() string {
+	if s.Target != "" {
+		return s.Target
+	}
+	return s.Name
+}
+
+// value returns the secret value, reading it from the file if configured.
+func (s Secret) value() ([]byte, error) {
+	if s.File == "" {
+		return []byte(s.Value), nil
+	}
+	value, err := os.ReadFile(s.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the file of secret %s (%w)", s.Name, err)
+	}
+	return value, nil
+}
+
+// podmanName returns the name of the ephemeral podman secret of the container, which must be unique on the podman host.
+func (s Secret) podmanName(containerName string) string {
+	return containerName + "_" + s.Name
+}
+
+// spec formats the secret for podman run --secret.
+func (s Secret) spec(containerName string) string {
+	secretType := s.Type
+	if secretType == "" {
+		secretType = SecretTypeMount
+	}
+	return fmt.Sprintf("%s,type=%s,target=%s", s.podmanName(containerName), secretType, s.target())
+}
+
+// validateSecrets checks each secret and rejects multiple secrets with the same name.
+func validateSecrets(secrets []Secret) error {
+	names := make(map[string]bool, len(secrets))
+	for _, s := range secrets {
+		if err := s.validate(); err != nil {
+			return err
+		}
+		if names[s.Name] {
+			return fmt.Errorf("multiple secrets have the name %s", s.Name)
+		}
+		names[s.Name] = true
+	}
+	return nil
+}
+
+// secretSpecs formats the secrets of the container for podman run --secret.
+func secretSpecs(secrets []Secret, containerName string) []string {
+	specs := make([]string, len(secrets))
+	for i, s := range secrets {
+		specs[i] = s.spec(containerName)
+	}
+	return specs
+}
+
+// createSecrets creates the ephemeral podman secrets of the container and returns their names. The secrets created
+// before a failure are removed again.
+func createSecrets(
+	ctx context.Context,
+	wrapper cliwrapper.CliWrapper,
+	secrets []Secret,
+	containerName string,
+) ([]string, error) {
+	names := make([]string, 0, len(secrets))
+	for _, s := range secrets {
+		value, err := s.value()
+		if err == nil {
+			err = wrapper.CreateSecret(ctx, s.podmanName(containerName), value)
+		}
+		if err != nil {
+			if removeErr := removeSecrets(context.Background(), wrapper, names); removeErr != nil {
+				err = errors.Join(err, removeErr)
+			}
+			return nil, err
+		}
+		names = append(names, s.podmanName(containerName))
+	}
+	return names, nil
+}
+
+// removeSecrets removes the ephemeral podman secrets, attempting all of them even if some fail.
+func removeSecrets(ctx context.Context, wrapper cliwrapper.CliWrapper, names []string) error {
+	var errs []error
+	for _, name := range names {
+		if err := wrapper.RemoveSecret(ctx, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -7,9 +7,11 @@ import (
 	log "go.arcalot.io/log/v2"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
+	"testing"
 	"time"
 )
 
@@ -130,6 +132,18 @@ func GetPodmanPsNsWithFormat(logger log.Logger, podmanPath string, containerName
 	return strings.TrimSuffix(stdoutContainer.String(), "\n")
 }
 
+// ExecInContainer runs a command inside the running container and returns its
+// output with the trailing newline removed.
+func ExecInContainer(logger log.Logger, podmanPath string, containerName string, command ...string) string {
+	var stdout bytes.Buffer
+	cmd := exec.Command(podmanPath, append([]string{"exec", containerName}, command...)...) //nolint:gosec
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		logger.Errorf(err.Error())
+	}
+	return strings.TrimSuffix(stdout.String(), "\n")
+}
+
 func IsRunningOnGithub() bool {
 	githubEnv := os.Getenv("GITHUB_ACTION")
 	return githubEnv != ""
@@ -139,3 +153,68 @@ func IsRunningOnLinux() bool {
 	//goland:noinspection GoBoolExpressions  // The linter cannot tell that this expression is not constant.
 	return runtime.GOOS == "linux"
 }
+
+// fakePodmanHeader records every invocation of the fake podman binary as a
+// single line in the invocation log and answers podman version and podman
+// info, then hands over to the test-provided body.
+const fakePodmanHeader = `#!/bin/bash
+echo "$*" >> %q
+for arg in "$@"; do
+  case "$arg" in
+    --connection=*|--url=*|--identity=*) ;;
+    version) echo '%s'; exit 0 ;;
+    info) echo '%s'; exit 0 ;;
+    *) break ;;
+  esac
+done
+`
+
+// FakePodmanVersion and FakePodmanInfo are the default podman version and
+// podman info outputs of the fake podman binary, describing a rootless podman
+// 4.9.3 on a cgroup v2 host.
+const (
+	FakePodmanVersion = `{"Client":{"APIVersion":"4.9.3","Version":"4.9.3"}}`
+	FakePodmanInfo    = `{"host":{"cgroupVersion":"v2","networkBackend":"netavark",` +
+		`"ociRuntime":{"name":"crun"},"security":{"rootless":true}},"version":{"APIVersion":"4.9.3","Version":"4.9.3"}}`
+)
+
+// CreateFakePodman writes an executable shell script which stands in for the
+// podman binary, so that tests can verify which podman commands the deployer
+// runs without requiring a working Podman installation.  The script body
+// receives the podman arguments in "$@" and decides how to respond (e.g.,
+// via a case statement on "$1").  Returns the path of the script and the path
+// of the log file into which each invocation's arguments are recorded.
+func CreateFakePodman(t *testing.T, scriptBody string) (podmanPath string, invocationLog string) {
+	return CreateFakePodmanHost(t, FakePodmanVersion, FakePodmanInfo, scriptBody)
+}
+
+// CreateFakePodmanHost writes a fake podman binary like CreateFakePodman,
+// which outputs the given JSON for podman version and podman info.
+func CreateFakePodmanHost(
+	t *testing.T,
+	versionOutput string,
+	infoOutput string,
+	scriptBody string,
+) (podmanPath string, invocationLog string) {
+	dir := t.TempDir()
+	podmanPath = filepath.Join(dir, "podman")
+	invocationLog = filepath.Join(dir, "invocations.log")
+	script := fmt.Sprintf(fakePodmanHeader, invocationLog, versionOutput, infoOutput) + scriptBody + "\n"
+	if err := os.WriteFile(podmanPath, []byte(script), 0o700); err != nil { //nolint:gosec // The script must be executable.
+		t.Fatalf("failed to write fake podman script (%s)", err)
+	}
+	return podmanPath, invocationLog
+}
+
+// GetFakePodmanInvocations returns the arguments of each invocation of the
+// fake podman binary, one entry per invocation, in the order they happened.
+func GetFakePodmanInvocations(t *testing.T, invocationLog string) []string {
+	content, err := os.ReadFile(invocationLog) //nolint:gosec // The path is created by the test.
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		t.Fatalf("failed to read fake podman invocation log (%s)", err)
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}